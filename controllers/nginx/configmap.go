@@ -0,0 +1,62 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bprashanth/Ingress/lib"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// configMapRef names a ConfigMap.
+type configMapRef struct {
+	namespace string
+	name      string
+}
+
+func (r *configMapRef) String() string {
+	return r.namespace + "/" + r.name
+}
+
+// configMapWatcher is a resourceWatcher of a single ConfigMap.
+func configMapWatcher(c *client.Client, ref *configMapRef) resourceWatcher {
+	return resourceWatcher{
+		kind: "configmap " + ref.String(),
+		list: func() (string, error) {
+			list, err := lib.ListConfigMaps(c, ref.namespace, ref.name)
+			if err != nil {
+				return "", err
+			}
+			return list.ResourceVersion, nil
+		},
+		watch: func(rv string) (watch.Interface, error) {
+			return lib.WatchConfigMaps(c, ref.namespace, ref.name, rv)
+		},
+	}
+}
+
+// parseNamespacedName splits a "namespace/name" flag value.
+func parseNamespacedName(s string) (namespace, name string, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%q is not of the form namespace/name", s)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,514 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bprashanth/Ingress/controllers/nginx/nginx"
+	"github.com/bprashanth/Ingress/lib"
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/util"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+const (
+	// rewatchPeriod is how long to wait before listing a resource again
+	// after its watch failed.
+	rewatchPeriod = time.Second
+
+	// controllerName is the source of events recorded by the controller.
+	controllerName = "nginx-ingress-controller"
+)
+
+// loadBalancerController renders the Ingresses of a namespace into an
+// nginx config, and reloads nginx whenever the config changes.
+type loadBalancerController struct {
+	client    *client.Client
+	namespace string
+	resync    time.Duration
+	manager   *nginx.Manager
+	// sslDir is where the certs of receivers are written.
+	sslDir string
+	// authDir is where the htpasswd files of Ingresses with basic auth are
+	// written.
+	authDir string
+
+	// configMap holds the global nginx settings, nil to always use
+	// globalDefaults.
+	configMap      *configMapRef
+	globalDefaults nginx.GlobalConfig
+	// global is the last valid global config, only used by sync.
+	global nginx.GlobalConfig
+
+	// templateSource is the user supplied template, nil to always render
+	// nginx.DefaultTemplate.
+	templateSource *templateSource
+	// templateLock guards the last valid template and its text.
+	templateLock sync.Mutex
+	template     *nginx.Template
+	templateText string
+
+	// appliedVersions are the resource versions of the Ingresses in the
+	// last config nginx accepted, keyed by namespace/name. Only those that
+	// changed since are blamed for a rejected config.
+	appliedVersions map[string]string
+
+	// syncCh is signalled whenever a watched resource changes.
+	syncCh chan struct{}
+}
+
+func newLoadBalancerController(c *client.Client, namespace string, resync time.Duration, manager *nginx.Manager, sslDir, authDir string, configMap *configMapRef, globalDefaults nginx.GlobalConfig, templateSource *templateSource) *loadBalancerController {
+	return &loadBalancerController{
+		client:         c,
+		namespace:      namespace,
+		resync:         resync,
+		manager:        manager,
+		sslDir:         sslDir,
+		authDir:        authDir,
+		configMap:      configMap,
+		globalDefaults: globalDefaults,
+		global:         globalDefaults,
+		templateSource: templateSource,
+		template:       nginx.DefaultTemplate,
+		syncCh:         make(chan struct{}, 1),
+	}
+}
+
+// resourceWatcher lists and watches a single kind of resource.
+type resourceWatcher struct {
+	kind  string
+	list  func() (resourceVersion string, err error)
+	watch func(resourceVersion string) (watch.Interface, error)
+	// changed, if set, is called on every change instead of requesting a
+	// sync.
+	changed func()
+}
+
+// watchers returns the resources whose changes require a sync.
+func (lbc *loadBalancerController) watchers() []resourceWatcher {
+	ns := lbc.namespace
+	everything := func() (labels.Selector, fields.Selector) { return labels.Everything(), fields.Everything() }
+	watchers := []resourceWatcher{
+		{
+			kind: "ingress",
+			list: func() (string, error) {
+				l, err := lbc.client.Experimental().Ingress(ns).List(everything())
+				if err != nil {
+					return "", err
+				}
+				return l.ResourceVersion, nil
+			},
+			watch: func(rv string) (watch.Interface, error) {
+				label, field := everything()
+				return lbc.client.Experimental().Ingress(ns).Watch(label, field, rv)
+			},
+		},
+		{
+			kind: "service",
+			list: func() (string, error) {
+				l, err := lbc.client.Services(ns).List(labels.Everything())
+				if err != nil {
+					return "", err
+				}
+				return l.ResourceVersion, nil
+			},
+			watch: func(rv string) (watch.Interface, error) {
+				label, field := everything()
+				return lbc.client.Services(ns).Watch(label, field, rv)
+			},
+		},
+		{
+			kind: "endpoints",
+			list: func() (string, error) {
+				l, err := lbc.client.Endpoints(ns).List(labels.Everything())
+				if err != nil {
+					return "", err
+				}
+				return l.ResourceVersion, nil
+			},
+			watch: func(rv string) (watch.Interface, error) {
+				label, field := everything()
+				return lbc.client.Endpoints(ns).Watch(label, field, rv)
+			},
+		},
+		{
+			kind: "secret",
+			list: func() (string, error) {
+				l, err := lbc.client.Secrets(ns).List(everything())
+				if err != nil {
+					return "", err
+				}
+				return l.ResourceVersion, nil
+			},
+			watch: func(rv string) (watch.Interface, error) {
+				label, field := everything()
+				return lbc.client.Secrets(ns).Watch(label, field, rv)
+			},
+		},
+	}
+	if lbc.configMap != nil {
+		watchers = append(watchers, configMapWatcher(lbc.client, lbc.configMap))
+	}
+	if lbc.templateSource != nil && lbc.templateSource.configMap != nil {
+		w := configMapWatcher(lbc.client, lbc.templateSource.configMap)
+		w.changed = lbc.reloadTemplate
+		watchers = append(watchers, w)
+	}
+	return watchers
+}
+
+// enqueue requests a sync, coalescing requests that arrive while one is
+// already pending.
+func (lbc *loadBalancerController) enqueue() {
+	select {
+	case lbc.syncCh <- struct{}{}:
+	default:
+	}
+}
+
+// notify calls the changed hook of the watcher, or requests a sync.
+func (w resourceWatcher) notify(lbc *loadBalancerController) {
+	if w.changed != nil {
+		w.changed()
+		return
+	}
+	lbc.enqueue()
+}
+
+// follow lists and watches a resource until stopCh is closed, requesting a
+// sync on every change.
+func (lbc *loadBalancerController) follow(w resourceWatcher, stopCh <-chan struct{}) {
+	for {
+		rv, err := w.list()
+		if err == nil {
+			w.notify(lbc)
+			err = lbc.watchFrom(w, rv, stopCh)
+		}
+		if err != nil {
+			glog.Errorf("Error watching %v: %v", w.kind, err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(rewatchPeriod):
+		}
+	}
+}
+
+func (lbc *loadBalancerController) watchFrom(w resourceWatcher, rv string, stopCh <-chan struct{}) error {
+	wi, err := w.watch(rv)
+	if err != nil {
+		return err
+	}
+	defer wi.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case event, ok := <-wi.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type == watch.Error {
+				return fmt.Errorf("watch error: %+v", event.Object)
+			}
+			glog.V(4).Infof("%v %v", event.Type, w.kind)
+			w.notify(lbc)
+		}
+	}
+}
+
+// loadTemplate reads the user supplied template and, if it changed and is
+// valid, makes it the template of future syncs. It returns true if the
+// template changed. An invalid template is ignored, leaving the last valid
+// one in place.
+func (lbc *loadBalancerController) loadTemplate() (bool, error) {
+	text, err := lbc.templateSource.load()
+	if err != nil {
+		return false, err
+	}
+	lbc.templateLock.Lock()
+	defer lbc.templateLock.Unlock()
+	if text == lbc.templateText {
+		return false, nil
+	}
+	tmpl, err := nginx.NewTemplate(lbc.templateSource.desc, text)
+	if err != nil {
+		return false, err
+	}
+	lbc.template, lbc.templateText = tmpl, text
+	return true, nil
+}
+
+// reloadTemplate reloads the user supplied template and requests a sync
+// when it changed.
+func (lbc *loadBalancerController) reloadTemplate() {
+	changed, err := lbc.loadTemplate()
+	if err != nil {
+		glog.Errorf("Ignoring template from %v: %v", lbc.templateSource.desc, err)
+	} else if changed {
+		glog.Infof("Template from %v changed, requesting sync", lbc.templateSource.desc)
+		lbc.enqueue()
+	}
+}
+
+func (lbc *loadBalancerController) currentTemplate() *nginx.Template {
+	lbc.templateLock.Lock()
+	defer lbc.templateLock.Unlock()
+	return lbc.template
+}
+
+// Run watches resources and syncs nginx until stopCh is closed.
+func (lbc *loadBalancerController) Run(stopCh <-chan struct{}) {
+	for _, w := range lbc.watchers() {
+		go lbc.follow(w, stopCh)
+	}
+	if lbc.templateSource != nil && lbc.templateSource.configMap == nil {
+		go util.Until(lbc.reloadTemplate, templatePollPeriod, stopCh)
+	}
+	resync := time.NewTicker(lbc.resync)
+	defer resync.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-resync.C:
+			// A rejected config may have failed for a transient reason.
+			lbc.manager.RetryRejected()
+		case <-lbc.syncCh:
+		}
+		if err := lbc.sync(); err != nil {
+			glog.Errorf("Failed to sync nginx: %v", err)
+		}
+	}
+}
+
+// sync renders the current Ingresses and reloads nginx if the config
+// changed.
+func (lbc *loadBalancerController) sync() error {
+	ings, err := lbc.client.Experimental().Ingress(lbc.namespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return err
+	}
+	t := &nginx.Translator{
+		Global: lbc.globalConfig(),
+		GetService: func(namespace, name string) (*api.Service, error) {
+			return lbc.client.Services(namespace).Get(name)
+		},
+		GetEndpoints: func(namespace, name string) (*api.Endpoints, error) {
+			return lbc.client.Endpoints(namespace).Get(name)
+		},
+		WriteCert:     lbc.writeCert,
+		WriteCA:       lbc.writeCA,
+		WriteHtpasswd: lbc.writeHtpasswd,
+	}
+	cfg, errs := t.Translate(ings.Items)
+	for _, err := range errs {
+		glog.Warningf("%v", err)
+	}
+	conf, err := lbc.currentTemplate().Render(cfg)
+	if err != nil {
+		return err
+	}
+	err = lbc.manager.Apply(conf)
+	if rejected, ok := err.(*nginx.RejectedError); ok && !rejected.Repeated {
+		if changed := lbc.changedIngresses(ings.Items); len(changed) != 0 {
+			lbc.recordEvent(changed, "ConfigRejected", err.Error())
+		} else {
+			glog.Warningf("Config rejected without any Ingress changing since the last accepted config")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	lbc.appliedVersions = map[string]string{}
+	for _, ing := range ings.Items {
+		lbc.appliedVersions[ing.Namespace+"/"+ing.Name] = ing.ResourceVersion
+	}
+	return nil
+}
+
+// changedIngresses returns the Ingresses that were added or modified since
+// the last config nginx accepted, or all of them if it hasn't accepted one.
+func (lbc *loadBalancerController) changedIngresses(ings []extensions.Ingress) []extensions.Ingress {
+	changed := []extensions.Ingress{}
+	for _, ing := range ings {
+		if rv, ok := lbc.appliedVersions[ing.Namespace+"/"+ing.Name]; !ok || rv != ing.ResourceVersion {
+			changed = append(changed, ing)
+		}
+	}
+	return changed
+}
+
+// globalConfig returns the global settings in the controller ConfigMap. If
+// the ConfigMap can't be read or is invalid, the last valid settings are
+// kept. A missing ConfigMap means the defaults.
+func (lbc *loadBalancerController) globalConfig() nginx.GlobalConfig {
+	if lbc.configMap == nil {
+		return lbc.globalDefaults
+	}
+	cm, err := lib.GetConfigMap(lbc.client, lbc.configMap.namespace, lbc.configMap.name)
+	if errors.IsNotFound(err) {
+		lbc.global = lbc.globalDefaults
+		return lbc.global
+	} else if err != nil {
+		glog.Errorf("Failed to get configmap %v, keeping the last global config: %v", lbc.configMap, err)
+		return lbc.global
+	}
+	global, err := nginx.ParseGlobalConfig(cm.Data, lbc.globalDefaults)
+	if err != nil {
+		glog.Errorf("Ignoring configmap %v, keeping the last global config: %v", lbc.configMap, err)
+		return lbc.global
+	}
+	lbc.global = global
+	return global
+}
+
+// recordEvent creates a warning event on each of the given Ingresses.
+func (lbc *loadBalancerController) recordEvent(ings []extensions.Ingress, reason, message string) {
+	now := unversioned.Now()
+	for _, ing := range ings {
+		event := &api.Event{
+			ObjectMeta: api.ObjectMeta{
+				Name:      fmt.Sprintf("%v.%x", ing.Name, now.UnixNano()),
+				Namespace: ing.Namespace,
+			},
+			InvolvedObject: api.ObjectReference{
+				Kind:            "Ingress",
+				Namespace:       ing.Namespace,
+				Name:            ing.Name,
+				UID:             ing.UID,
+				ResourceVersion: ing.ResourceVersion,
+			},
+			Reason:         reason,
+			Message:        message,
+			Source:         api.EventSource{Component: controllerName},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if _, err := lbc.client.Events(ing.Namespace).Create(event); err != nil {
+			glog.Errorf("Failed to record event on Ingress %v/%v: %v", ing.Namespace, ing.Name, err)
+		}
+	}
+}
+
+// secretFile returns the path in dir of a file written from the given
+// secret. Namespace and secret names can't contain underscores, so secrets
+// of different namespaces never share a file.
+func secretFile(dir, namespace, secret, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%v_%v%v", namespace, secret, ext))
+}
+
+// contentVersion returns a short hash of data for the names of files that
+// nginx only reads on reload. A secret that changes is then written to a
+// new path, which changes the config and reloads nginx.
+func contentVersion(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
+
+// writeCert writes the keypair in the given secret to sslDir, and returns
+// the paths of the cert and key. The paths change with the keypair.
+func (lbc *loadBalancerController) writeCert(namespace, secret string) (string, string, error) {
+	cert, err := lib.ResolveCert(lib.ClientSecretGetter(lbc.client), namespace, lib.Receiver{Cert: secret})
+	if err != nil {
+		return "", "", err
+	}
+	version := "_" + contentVersion(cert.CertPEM, cert.KeyPEM)
+	crt, key := secretFile(lbc.sslDir, namespace, secret, version+".crt"), secretFile(lbc.sslDir, namespace, secret, version+".key")
+	if err := nginx.WriteFileAtomic(crt, cert.CertPEM, 0644); err != nil {
+		return "", "", err
+	}
+	if err := nginx.WriteFileAtomic(key, cert.KeyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	return crt, key, nil
+}
+
+// caKey is the key of the CA bundle in a secret.
+const caKey = "ca.crt"
+
+// writeCA writes the CA bundle in the given secret to sslDir, and returns
+// its path, which changes with the bundle.
+func (lbc *loadBalancerController) writeCA(namespace, secret string) (string, error) {
+	s, err := lbc.client.Secrets(namespace).Get(secret)
+	if err != nil {
+		return "", err
+	}
+	ca, ok := s.Data[caKey]
+	if !ok {
+		return "", fmt.Errorf("secret %v/%v has no %v", namespace, secret, caKey)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		return "", fmt.Errorf("%v of secret %v/%v holds no PEM encoded certificates", caKey, namespace, secret)
+	}
+	path := secretFile(lbc.sslDir, namespace, secret, "_ca_"+contentVersion(ca)+".crt")
+	if err := nginx.WriteFileAtomic(path, ca, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// htpasswdKey is the key of the htpasswd file in a secret.
+const htpasswdKey = "auth"
+
+// writeHtpasswd writes the htpasswd file in the given secret to authDir,
+// and returns its path. The file is only readable by its owner and group,
+// which nginx workers must belong to. Nginx reads it on every request, so
+// a change to the secret applies without a reload.
+func (lbc *loadBalancerController) writeHtpasswd(namespace, secret string) (string, error) {
+	s, err := lbc.client.Secrets(namespace).Get(secret)
+	if err != nil {
+		return "", err
+	}
+	htpasswd, ok := s.Data[htpasswdKey]
+	if !ok {
+		return "", fmt.Errorf("secret %v/%v has no %v", namespace, secret, htpasswdKey)
+	}
+	for i, line := range strings.Split(string(htpasswd), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", fmt.Errorf("line %d of %v in secret %v/%v is not user:password", i+1, htpasswdKey, namespace, secret)
+		}
+	}
+	path := secretFile(lbc.authDir, namespace, secret, ".htpasswd")
+	if err := nginx.WriteFileAtomic(path, htpasswd, 0640); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// An nginx Ingress controller. It watches Ingresses, Services, Endpoints
+// and Secrets, renders them into an nginx config and reloads nginx
+// whenever that config changes.
+package main
+
+import (
+	goflag "flag"
+	"os"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
+
+	"github.com/bprashanth/Ingress/controllers/nginx/nginx"
+	"github.com/golang/glog"
+)
+
+var (
+	flags = flag.NewFlagSet("", flag.ExitOnError)
+
+	kubeconfig = flags.String("kubeconfig", "",
+		`Path to a kubeconfig file. If empty, the in-cluster config of the pod's service account is used.`)
+	namespace = flags.String("namespace", api.NamespaceAll,
+		`Namespace to watch Ingresses in. Defaults to all namespaces.`)
+	resyncPeriod = flags.Duration("resync-period", 30*time.Second,
+		`Period at which nginx is synced with the cluster, even if no watch event was received.`)
+	nginxBinary = flags.String("nginx", "nginx", `Path to the nginx binary.`)
+	configPath  = flags.String("config", "/etc/nginx/nginx.conf",
+		`Path the rendered nginx config is written to.`)
+	stagingPath = flags.String("staging-config", "/etc/nginx/nginx.conf.staging",
+		`Path candidate configs are written to and validated at before they replace --config.`)
+	sslDir = flags.String("ssl-dir", "/etc/nginx/ssl",
+		`Directory the certs of receivers are written to.`)
+	authDir = flags.String("auth-dir", "/etc/nginx/auth",
+		`Directory the htpasswd files of Ingresses with basic auth are written to. Nginx workers must be in the group of the controller to read them.`)
+	workerConnections = flags.Int("worker-connections", 1024,
+		`Maximum number of simultaneous connections of an nginx worker, unless set in --configmap.`)
+	configMapName = flags.String("configmap", "",
+		`namespace/name of a ConfigMap holding global nginx settings, eg: worker-processes. It's watched for changes, and settings it doesn't hold keep their defaults.`)
+	templatePath = flags.String("template", "",
+		`Path to a text/template that replaces the built in nginx config template. Changes to the file are picked up without a restart.`)
+	templateConfigMap = flags.String("template-configmap", "",
+		`namespace/name of a ConfigMap whose "`+templateKey+`" key replaces the built in nginx config template. Mutually exclusive with --template.`)
+)
+
+func main() {
+	// Register the glog flags, eg: --v and --logtostderr.
+	flags.AddGoFlagSet(goflag.CommandLine)
+	flags.Parse(os.Args)
+
+	var config *client.Config
+	var err error
+	if *kubeconfig == "" {
+		config, err = client.InClusterConfig()
+	} else {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeconfig},
+			&clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+	if err != nil {
+		glog.Fatalf("error connecting to the client: %v", err)
+	}
+	kubeClient, err := client.New(config)
+	if err != nil {
+		glog.Fatalf("error creating kube client %v", err)
+	}
+
+	manager := &nginx.Manager{
+		ConfigPath:  *configPath,
+		StagingPath: *stagingPath,
+		Validator:   &nginx.CommandValidator{Binary: *nginxBinary},
+		Reloader:    &nginx.Process{Binary: *nginxBinary},
+	}
+	var tmplSource *templateSource
+	switch {
+	case *templatePath != "" && *templateConfigMap != "":
+		glog.Fatalf("--template and --template-configmap are mutually exclusive")
+	case *templatePath != "":
+		tmplSource = fileTemplate(*templatePath)
+	case *templateConfigMap != "":
+		ns, name, err := parseNamespacedName(*templateConfigMap)
+		if err != nil {
+			glog.Fatalf("invalid --template-configmap: %v", err)
+		}
+		tmplSource = configMapTemplate(kubeClient, &configMapRef{namespace: ns, name: name})
+	}
+
+	var cmRef *configMapRef
+	if *configMapName != "" {
+		ns, name, err := parseNamespacedName(*configMapName)
+		if err != nil {
+			glog.Fatalf("invalid --configmap: %v", err)
+		}
+		cmRef = &configMapRef{namespace: ns, name: name}
+	}
+	globalDefaults := nginx.DefaultGlobalConfig()
+	globalDefaults.WorkerConnections = *workerConnections
+
+	lbc := newLoadBalancerController(kubeClient, *namespace, *resyncPeriod, manager, *sslDir, *authDir, cmRef, globalDefaults, tmplSource)
+	if tmplSource != nil {
+		// Refuse to start with a broken template, later changes that
+		// break it are logged and ignored.
+		if _, err := lbc.loadTemplate(); err != nil {
+			glog.Fatalf("invalid template from %v: %v", tmplSource.desc, err)
+		}
+	}
+	lbc.Run(make(chan struct{}))
+}
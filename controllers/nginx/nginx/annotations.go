@@ -0,0 +1,498 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	utilerrors "k8s.io/kubernetes/pkg/util/errors"
+	"k8s.io/kubernetes/pkg/util/fielderrors"
+	"k8s.io/kubernetes/pkg/util/validation"
+)
+
+const (
+	// serviceUpstreamKey proxies to the cluster IP of a service instead of
+	// its endpoints when set to "true".
+	serviceUpstreamKey = "Ingress.nginx.service-upstream"
+
+	// sslRedirectKey opts an Ingress out of redirecting plain http to its
+	// TLS servers when set to "false".
+	sslRedirectKey = "Ingress.nginx.ssl-redirect"
+
+	// Keys of the ProxySettings of every location of an Ingress.
+	proxyConnectTimeoutKey = "Ingress.nginx.proxy-connect-timeout"
+	proxyReadTimeoutKey    = "Ingress.nginx.proxy-read-timeout"
+	clientMaxBodySizeKey   = "Ingress.nginx.client-max-body-size"
+	proxyBufferingKey      = "Ingress.nginx.proxy-buffering"
+
+	// backendProtocolKey sets the protocol of every backend of an Ingress,
+	// instead of the one implied by the name of its service port.
+	backendProtocolKey = "Ingress.nginx.backend-protocol"
+
+	// Keys of the UpstreamTLS of HTTPS and GRPCS backends.
+	proxySSLVerifyKey     = "Ingress.nginx.proxy-ssl-verify"
+	proxySSLCASecretKey   = "Ingress.nginx.proxy-ssl-ca-secret"
+	proxySSLNameKey       = "Ingress.nginx.proxy-ssl-name"
+	proxySSLServerNameKey = "Ingress.nginx.proxy-ssl-server-name"
+
+	// Keys of the client cert authentication of the TLS servers of an
+	// Ingress.
+	authTLSSecretKey        = "Ingress.nginx.auth-tls-secret"
+	authTLSVerifyClientKey  = "Ingress.nginx.auth-tls-verify-client"
+	authTLSVerifyDepthKey   = "Ingress.nginx.auth-tls-verify-depth"
+	authTLSSubjectHeaderKey = "Ingress.nginx.auth-tls-subject-header"
+
+	// Keys of the rate and connection limits of every location of an
+	// Ingress.
+	limitRPSKey         = "Ingress.nginx.limit-rps"
+	limitBurstKey       = "Ingress.nginx.limit-burst"
+	limitNoDelayKey     = "Ingress.nginx.limit-nodelay"
+	limitConnectionsKey = "Ingress.nginx.limit-connections"
+	limitWhitelistKey   = "Ingress.nginx.limit-whitelist"
+
+	// Keys of the basic authentication of every location of an Ingress.
+	authSecretKey = "Ingress.nginx.auth-secret"
+	authRealmKey  = "Ingress.nginx.auth-realm"
+
+	// Keys of the external authentication of every server of an Ingress.
+	authURLKey             = "Ingress.nginx.auth-url"
+	authRequestHeadersKey  = "Ingress.nginx.auth-request-headers"
+	authResponseHeadersKey = "Ingress.nginx.auth-response-headers"
+	authSigninKey          = "Ingress.nginx.auth-signin"
+
+	// Keys of the IPs and CIDRs of clients let through or rejected by the
+	// servers of an Ingress.
+	allowSourceRangeKey = "Ingress.nginx.allow-source-range"
+	denySourceRangeKey  = "Ingress.nginx.deny-source-range"
+
+	// defaultAuthRealm is the realm of basic authentication without an
+	// auth-realm annotation.
+	defaultAuthRealm = "Authentication Required"
+
+	// maxConnectTimeout is the longest proxy_connect_timeout nginx honours.
+	maxConnectTimeout = 75 * time.Second
+)
+
+// headerRegexp matches an http header name.
+var headerRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// sizeRegexp matches an nginx size, eg: 512, 10k or 8m.
+var sizeRegexp = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// ingAnnotations are the nginx specific annotations of an Ingress.
+type ingAnnotations map[string]string
+
+// serviceUpstream returns true if the Ingress asked to be proxied through
+// the cluster IP of its services.
+func (a ingAnnotations) serviceUpstream() (bool, error) {
+	v, ok := a[serviceUpstreamKey]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v annotation %q: must be true or false", serviceUpstreamKey, v)
+	}
+	return b, nil
+}
+
+// sslRedirect returns false if the Ingress opted out of redirecting plain
+// http to TLS.
+func (a ingAnnotations) sslRedirect() (bool, error) {
+	v, ok := a[sslRedirectKey]
+	if !ok {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return true, fmt.Errorf("invalid %v annotation %q: must be true or false", sslRedirectKey, v)
+	}
+	return b, nil
+}
+
+// proxySettings returns the ProxySettings of the Ingress. Invalid values
+// are left out of the settings and reported in the error, so a typo in one
+// annotation doesn't discard the others.
+func (a ingAnnotations) proxySettings() (ProxySettings, error) {
+	p := ProxySettings{}
+	allErrs := fielderrors.ValidationErrorList{}
+	if v, ok := a[proxyConnectTimeoutKey]; ok {
+		if d, err := parseTimeout(proxyConnectTimeoutKey, v, maxConnectTimeout); err != nil {
+			allErrs = append(allErrs, err)
+		} else {
+			p.ConnectTimeout = d
+		}
+	}
+	if v, ok := a[proxyReadTimeoutKey]; ok {
+		if d, err := parseTimeout(proxyReadTimeoutKey, v, 0); err != nil {
+			allErrs = append(allErrs, err)
+		} else {
+			p.ReadTimeout = d
+		}
+	}
+	if v, ok := a[clientMaxBodySizeKey]; ok {
+		if !sizeRegexp.MatchString(v) {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(clientMaxBodySizeKey, v, "must be a size in bytes, optionally suffixed with k, m or g"))
+		} else {
+			p.ClientMaxBodySize = v
+		}
+	}
+	if v, ok := a[proxyBufferingKey]; ok {
+		if b, err := strconv.ParseBool(v); err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(proxyBufferingKey, v, "must be true or false"))
+		} else {
+			p.Buffering = &b
+		}
+	}
+	if len(allErrs) != 0 {
+		return p, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return p, nil
+}
+
+// backendSettings are the protocol annotations of an Ingress.
+type backendSettings struct {
+	// protocol is empty to pick the protocol from the service port name.
+	protocol BackendProtocol
+	verify   bool
+	caSecret string
+	sslName  string
+	sni      bool
+}
+
+// backendSettings returns the protocol settings of the Ingress. Like
+// proxySettings, invalid values are left out and reported in the error.
+func (a ingAnnotations) backendSettings() (backendSettings, error) {
+	b := backendSettings{}
+	allErrs := fielderrors.ValidationErrorList{}
+	if v, ok := a[backendProtocolKey]; ok {
+		switch p := BackendProtocol(strings.ToUpper(v)); p {
+		case ProtocolHTTP, ProtocolHTTPS, ProtocolHTTP2, ProtocolGRPC, ProtocolGRPCS:
+			b.protocol = p
+		default:
+			allErrs = append(allErrs, fielderrors.NewFieldValueNotSupported(backendProtocolKey, v,
+				[]string{string(ProtocolHTTP), string(ProtocolHTTPS), string(ProtocolHTTP2), string(ProtocolGRPC), string(ProtocolGRPCS)}))
+		}
+	}
+	if v, ok := a[proxySSLVerifyKey]; ok {
+		if verify, err := strconv.ParseBool(v); err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(proxySSLVerifyKey, v, "must be true or false"))
+		} else {
+			b.verify = verify
+		}
+	}
+	if v, ok := a[proxySSLCASecretKey]; ok {
+		if !validation.IsDNS1123Subdomain(v) {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(proxySSLCASecretKey, v, "must be the name of a secret"))
+		} else {
+			b.caSecret = v
+		}
+	}
+	if v, ok := a[proxySSLNameKey]; ok {
+		if !validation.IsDNS1123Subdomain(v) {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(proxySSLNameKey, v, "must be a DNS-1123 subdomain"))
+		} else {
+			b.sslName = v
+		}
+	}
+	if v, ok := a[proxySSLServerNameKey]; ok {
+		if sni, err := strconv.ParseBool(v); err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(proxySSLServerNameKey, v, "must be true or false"))
+		} else {
+			b.sni = sni
+		}
+	}
+	if len(allErrs) != 0 {
+		return b, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return b, nil
+}
+
+// clientAuthSettings are the client cert annotations of an Ingress.
+type clientAuthSettings struct {
+	caSecret      string
+	verify        string
+	depth         int
+	subjectHeader string
+}
+
+// clientAuthSettings returns the client cert settings of the Ingress, nil
+// if it doesn't name a CA secret. Unlike the other annotations, any invalid
+// value discards the settings, and the caller must fail the TLS servers of
+// the Ingress rather than serve them without authentication.
+func (a ingAnnotations) clientAuthSettings() (*clientAuthSettings, error) {
+	secret, ok := a[authTLSSecretKey]
+	if !ok {
+		return nil, nil
+	}
+	c := &clientAuthSettings{caSecret: secret, verify: "on", depth: 1}
+	allErrs := fielderrors.ValidationErrorList{}
+	if !validation.IsDNS1123Subdomain(secret) {
+		allErrs = append(allErrs, fielderrors.NewFieldInvalid(authTLSSecretKey, secret, "must be the name of a secret"))
+	}
+	if v, ok := a[authTLSVerifyClientKey]; ok {
+		switch v {
+		case "on", "optional", "optional_no_ca":
+			c.verify = v
+		default:
+			allErrs = append(allErrs, fielderrors.NewFieldValueNotSupported(authTLSVerifyClientKey, v, []string{"on", "optional", "optional_no_ca"}))
+		}
+	}
+	if v, ok := a[authTLSVerifyDepthKey]; ok {
+		if depth, err := strconv.Atoi(v); err != nil || depth < 1 {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(authTLSVerifyDepthKey, v, "must be a positive number"))
+		} else {
+			c.depth = depth
+		}
+	}
+	if v, ok := a[authTLSSubjectHeaderKey]; ok {
+		if !headerRegexp.MatchString(v) {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(authTLSSubjectHeaderKey, v, "must be an http header name"))
+		} else {
+			c.subjectHeader = v
+		}
+	}
+	if len(allErrs) != 0 {
+		return c, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return c, nil
+}
+
+// rateLimit returns the rate and connection limits of the Ingress, nil if
+// it has none. The ID of the returned limit isn't set. Like proxySettings,
+// invalid values are left out and reported in the error.
+func (a ingAnnotations) rateLimit() (*RateLimit, error) {
+	l := &RateLimit{}
+	allErrs := fielderrors.ValidationErrorList{}
+	parse := func(key string, min int) int {
+		v, ok := a[key]
+		if !ok {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(key, v, fmt.Sprintf("must be a number no less than %d", min)))
+			return 0
+		}
+		return n
+	}
+	l.RPS = parse(limitRPSKey, 1)
+	l.Burst = parse(limitBurstKey, 0)
+	l.Connections = parse(limitConnectionsKey, 1)
+	if l.Burst != 0 && l.RPS == 0 {
+		allErrs = append(allErrs, fielderrors.NewFieldInvalid(limitBurstKey, a[limitBurstKey], fmt.Sprintf("requires %v", limitRPSKey)))
+		l.Burst = 0
+	}
+	if v, ok := a[limitNoDelayKey]; ok {
+		noDelay, err := strconv.ParseBool(v)
+		if err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(limitNoDelayKey, v, "must be true or false"))
+		} else if noDelay && l.Burst == 0 {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(limitNoDelayKey, v, fmt.Sprintf("requires %v", limitBurstKey)))
+		} else {
+			l.NoDelay = noDelay
+		}
+	}
+	if v, ok := a[limitWhitelistKey]; ok {
+		for _, cidr := range strings.Split(v, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				allErrs = append(allErrs, fielderrors.NewFieldInvalid(limitWhitelistKey, cidr, "must be an IP or CIDR"))
+				continue
+			}
+			l.Whitelist = append(l.Whitelist, cidr)
+		}
+	}
+	var err error
+	if len(allErrs) != 0 {
+		err = fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	if l.RPS == 0 && l.Connections == 0 {
+		if len(l.Whitelist) != 0 && err == nil {
+			err = fmt.Errorf("%v has no effect without %v or %v", limitWhitelistKey, limitRPSKey, limitConnectionsKey)
+		}
+		return nil, err
+	}
+	return l, err
+}
+
+// basicAuthSettings are the basic authentication annotations of an
+// Ingress.
+type basicAuthSettings struct {
+	secret string
+	realm  string
+}
+
+// basicAuthSettings returns the basic authentication settings of the
+// Ingress, nil if it doesn't name an htpasswd secret. Any invalid value
+// discards the settings, and the caller must skip the Ingress rather than
+// serve it without authentication.
+func (a ingAnnotations) basicAuthSettings() (*basicAuthSettings, error) {
+	secret, ok := a[authSecretKey]
+	if !ok {
+		return nil, nil
+	}
+	b := &basicAuthSettings{secret: secret, realm: defaultAuthRealm}
+	allErrs := fielderrors.ValidationErrorList{}
+	if !validation.IsDNS1123Subdomain(secret) {
+		allErrs = append(allErrs, fielderrors.NewFieldInvalid(authSecretKey, secret, "must be the name of a secret"))
+	}
+	if v, ok := a[authRealmKey]; ok {
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(authRealmKey, v, "must not contain control characters"))
+		} else if strings.Contains(v, "$") {
+			// auth_basic expands variables, even in quoted strings.
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(authRealmKey, v, "must not contain $"))
+		} else {
+			b.realm = v
+		}
+	}
+	if len(allErrs) != 0 {
+		return b, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return b, nil
+}
+
+// externalAuth returns the external authentication of the Ingress, nil if
+// it has no auth URL. Like basicAuthSettings, any invalid value discards
+// the settings.
+func (a ingAnnotations) externalAuth() (*ExternalAuth, error) {
+	authURL, ok := a[authURLKey]
+	if !ok {
+		return nil, nil
+	}
+	e := &ExternalAuth{Path: externalAuthPath, URL: authURL}
+	allErrs := fielderrors.ValidationErrorList{}
+	if err := validateURL(authURL); err != nil {
+		allErrs = append(allErrs, fielderrors.NewFieldInvalid(authURLKey, authURL, err.Error()))
+	}
+	headers := func(key string) []string {
+		v, ok := a[key]
+		if !ok {
+			return nil
+		}
+		list := []string{}
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); !headerRegexp.MatchString(h) {
+				allErrs = append(allErrs, fielderrors.NewFieldInvalid(key, h, "must be an http header name"))
+				continue
+			}
+			list = append(list, h)
+		}
+		return list
+	}
+	e.RequestHeaders = headers(authRequestHeadersKey)
+	e.ResponseHeaders = headers(authResponseHeadersKey)
+	if v, ok := a[authSigninKey]; ok {
+		if err := validateURL(v); err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(authSigninKey, v, err.Error()))
+		} else {
+			e.SignIn = v
+		}
+	}
+	if len(allErrs) != 0 {
+		return nil, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return e, nil
+}
+
+// sourceRange returns the allowed and denied client ranges of the Ingress.
+// A nil list isn't set and falls back to the global config, an empty one
+// is set to nothing, eg: to lift a global restriction.
+func (a ingAnnotations) sourceRange() (allow, deny []string, err error) {
+	allErrs := fielderrors.ValidationErrorList{}
+	parse := func(key string) []string {
+		v, ok := a[key]
+		if !ok {
+			return nil
+		}
+		cidrs, err := parseCIDRs(key, v)
+		if err != nil {
+			allErrs = append(allErrs, err)
+		}
+		return cidrs
+	}
+	allow = parse(allowSourceRangeKey)
+	deny = parse(denySourceRangeKey)
+	if len(allErrs) != 0 {
+		return nil, nil, fmt.Errorf("invalid annotations: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return allow, deny, nil
+}
+
+// validateURL checks that s is an absolute http or https URL that's safe
+// to use as an unquoted nginx argument, without nginx variables.
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("must have a host")
+	}
+	if strings.ContainsAny(s, " \t\n;{}\"'") {
+		return fmt.Errorf("must not contain whitespace, quotes, braces or semicolons")
+	}
+	// proxy_pass and error_page expand variables.
+	if strings.Contains(s, "$") {
+		return fmt.Errorf("must not contain $")
+	}
+	return nil
+}
+
+// protocolForPort returns the protocol implied by the name of a service
+// port: https, grpc, grpcs, http2 or h2c, optionally followed by a dash and
+// a suffix, eg: grpc-api. Other names are plain HTTP.
+func protocolForPort(name string) BackendProtocol {
+	is := func(prefix string) bool {
+		return name == prefix || strings.HasPrefix(name, prefix+"-")
+	}
+	switch {
+	case is("https"):
+		return ProtocolHTTPS
+	case is("grpcs"):
+		return ProtocolGRPCS
+	case is("grpc"):
+		return ProtocolGRPC
+	case is("http2"), is("h2c"):
+		return ProtocolHTTP2
+	}
+	return ProtocolHTTP
+}
+
+// parseTimeout parses a positive duration in whole seconds, no longer than
+// max unless max is 0.
+func parseTimeout(key, v string, max time.Duration) (time.Duration, *fielderrors.ValidationError) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || d%time.Second != 0 {
+		return 0, fielderrors.NewFieldInvalid(key, v, "must be a positive duration in whole seconds, eg: 60s")
+	}
+	if max != 0 && d > max {
+		return 0, fielderrors.NewFieldInvalid(key, v, fmt.Sprintf("must be at most %v", max))
+	}
+	return d, nil
+}
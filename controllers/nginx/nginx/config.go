@@ -0,0 +1,316 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nginx translates Ingresses into an nginx config.
+package nginx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bprashanth/Ingress/lib"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+// Config is the complete state rendered into nginx.conf.
+type Config struct {
+	GlobalConfig
+	// Upstreams are sorted by name, one per backend referenced by Servers.
+	Upstreams []Upstream
+	// RateLimits are the limit zones referenced by locations.
+	RateLimits []*RateLimit
+	Servers    []Server
+}
+
+// RateLimit limits the requests per second and concurrent connections of
+// each client IP to a single location.
+type RateLimit struct {
+	// ID names the limit zones and variables of the limit.
+	ID string
+	// RPS is the requests per second, 0 for no request limit.
+	RPS int
+	// Burst is how many requests over RPS are queued before requests are
+	// rejected.
+	Burst int
+	// NoDelay serves the requests of a burst right away instead of
+	// spacing them out at RPS.
+	NoDelay bool
+	// Connections is the number of concurrent connections, 0 for no
+	// connection limit.
+	Connections int
+	// Whitelist holds the IPs and CIDRs that aren't limited.
+	Whitelist []string
+}
+
+// Key returns the variable the limit zones are keyed on: the client IP, or
+// an empty string, which nginx doesn't count, for whitelisted clients.
+func (r RateLimit) Key() string {
+	if len(r.Whitelist) == 0 {
+		return "$binary_remote_addr"
+	}
+	return "$" + r.ID + "_key"
+}
+
+// Upstream is an nginx upstream block balancing over the addresses of a
+// service port.
+type Upstream struct {
+	Name string
+	// Servers is empty if the service has no ready endpoints.
+	Servers []UpstreamServer
+}
+
+// UpstreamServer is a single address of an Upstream, either an endpoint
+// or the cluster IP of a service.
+type UpstreamServer struct {
+	Address string
+	Port    int
+}
+
+// Server is a single nginx server block.
+type Server struct {
+	// Name is the server_name, "_" for a catch-all server.
+	Name string
+	Port int
+	// SSLCert and SSLKey are paths to the serving cert on disk, empty for
+	// plain http.
+	SSLCert string
+	SSLKey  string
+	// HTTP2 enables HTTP/2 on the listener, for gRPC clients. It applies to
+	// every server on the same port.
+	HTTP2 bool
+	// ClientAuth, if set, requires clients of a TLS server to present a
+	// cert.
+	ClientAuth *ClientAuth
+	// SourceRange, if set, restricts the clients of the server.
+	SourceRange *SourceRange
+	// ExternalAuth, if set, checks every request to the server with an
+	// auth service before proxying it.
+	ExternalAuth *ExternalAuth
+	// Locations are rendered in order.
+	Locations []Location
+	// Redirect, if set, replaces the locations of a plain http server with
+	// a redirect to the TLS server of the same host.
+	Redirect *Redirect
+}
+
+// grpcOnly returns true if the server has locations and they're all gRPC.
+func (s Server) grpcOnly() bool {
+	for _, loc := range s.Locations {
+		if !loc.clientHTTP2() {
+			return false
+		}
+	}
+	return len(s.Locations) != 0
+}
+
+// ClientAuth verifies client certs against a CA bundle.
+type ClientAuth struct {
+	// CA is the path of the CA bundle.
+	CA string
+	// Verify is the ssl_verify_client mode: on, optional or optional_no_ca.
+	Verify string
+	Depth  int
+	// SubjectHeader, if set, is the header the subject of the client cert
+	// is passed to the backend in.
+	SubjectHeader string
+}
+
+// SourceRange restricts clients by IP. Clients in Deny are rejected, then
+// clients in Allow let through, and if Allow is set everyone else is
+// rejected.
+type SourceRange struct {
+	Allow []string
+	Deny  []string
+}
+
+// externalAuthPath is the internal location of the auth subrequest.
+const externalAuthPath = "/_external-auth"
+
+// ExternalAuth authenticates requests with a subrequest to an auth service.
+// A 2xx response lets the request through, a 401 or 403 rejects it.
+type ExternalAuth struct {
+	// Path is the internal location proxying to URL.
+	Path string
+	URL  string
+	// RequestHeaders, if set, are the only headers of the request sent to
+	// the auth service.
+	RequestHeaders []string
+	// ResponseHeaders are copied from the response of the auth service to
+	// the request proxied to the backend.
+	ResponseHeaders []string
+	// SignIn, if set, is where users are redirected when the auth service
+	// responds with a 401.
+	SignIn string
+}
+
+// SignInURL returns SignIn with a "rd" query parameter holding the URL of
+// the rejected request.
+func (e ExternalAuth) SignInURL() string {
+	sep := "?"
+	if strings.Contains(e.SignIn, "?") {
+		sep = "&"
+	}
+	return e.SignIn + sep + "rd=$scheme://$host$request_uri"
+}
+
+// Redirect sends requests to https on Port.
+type Redirect struct {
+	// Code is 301 or 308.
+	Code int
+	Port int
+}
+
+// URL returns the nginx expression of the URL to redirect to.
+func (r Redirect) URL() string {
+	if r.Port == 443 {
+		return "https://$host$request_uri"
+	}
+	return fmt.Sprintf("https://$host:%d$request_uri", r.Port)
+}
+
+// Location proxies requests matching Path to Backend.
+type Location struct {
+	Path    string
+	Match   lib.PathMatchType
+	Backend Backend
+	Proxy   ProxySettings
+	// RateLimit is nil for an unlimited location.
+	RateLimit *RateLimit
+	// BasicAuth is nil for a location without basic authentication.
+	BasicAuth *BasicAuth
+	// Protocol defaults to ProtocolHTTP.
+	Protocol BackendProtocol
+	// UpstreamTLS is set for the HTTPS and GRPCS protocols.
+	UpstreamTLS *UpstreamTLS
+}
+
+// BasicAuth requires the users of a location to log in with a password.
+type BasicAuth struct {
+	Realm string
+	// UserFile is the path of the htpasswd file.
+	UserFile string
+}
+
+// BackendProtocol is the protocol nginx speaks to a backend.
+type BackendProtocol string
+
+const (
+	ProtocolHTTP  BackendProtocol = "HTTP"
+	ProtocolHTTPS BackendProtocol = "HTTPS"
+	// ProtocolHTTP2 is cleartext HTTP/2. Nginx only speaks HTTP/2 to
+	// backends through its grpc module, so it's proxied with grpc_pass.
+	ProtocolHTTP2 BackendProtocol = "HTTP2"
+	ProtocolGRPC  BackendProtocol = "GRPC"
+	ProtocolGRPCS BackendProtocol = "GRPCS"
+)
+
+// IsGRPC returns true if the location is proxied by the grpc module.
+func (l Location) IsGRPC() bool {
+	return l.Protocol == ProtocolGRPC || l.Protocol == ProtocolGRPCS || l.Protocol == ProtocolHTTP2
+}
+
+// clientHTTP2 returns true if the clients of the location need HTTP/2 to
+// nginx, as gRPC clients do. HTTP2 backends are proxied by the grpc module
+// too, but their clients may still speak HTTP/1.
+func (l Location) clientHTTP2() bool {
+	return l.Protocol == ProtocolGRPC || l.Protocol == ProtocolGRPCS
+}
+
+// Pass returns the directive that proxies the location, proxy_pass or
+// grpc_pass.
+func (l Location) Pass() string {
+	if l.IsGRPC() {
+		return "grpc_pass"
+	}
+	return "proxy_pass"
+}
+
+// DirectivePrefix returns "grpc" or "proxy", the prefix of the directives
+// tuning the proxy of the location, eg: proxy_read_timeout.
+func (l Location) DirectivePrefix() string {
+	if l.IsGRPC() {
+		return "grpc"
+	}
+	return "proxy"
+}
+
+// URL returns the argument of the Pass directive.
+func (l Location) URL() string {
+	scheme := "http"
+	switch l.Protocol {
+	case ProtocolHTTPS:
+		scheme = "https"
+	case ProtocolGRPC, ProtocolHTTP2:
+		scheme = "grpc"
+	case ProtocolGRPCS:
+		scheme = "grpcs"
+	}
+	return scheme + "://" + l.Backend.UpstreamName()
+}
+
+// UpstreamTLS configures TLS between nginx and a backend.
+type UpstreamTLS struct {
+	// ServerName is the name the backend's cert is verified against, and
+	// sent as SNI if SNI is set.
+	ServerName string
+	SNI        bool
+	// TrustedCA is the path of the CA bundle the backend's cert is
+	// verified with, empty to skip verification.
+	TrustedCA string
+}
+
+// ProxySettings tune how a location proxies to its backend. Zero values
+// leave the nginx defaults in place.
+type ProxySettings struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	// ClientMaxBodySize is an nginx size, eg: 8m.
+	ClientMaxBodySize string
+	// Buffering is nil to leave proxy_buffering at its default.
+	Buffering *bool
+}
+
+// Modifier returns the nginx location modifier for the match type of the
+// location, including a trailing space if there is one.
+func (l Location) Modifier() string {
+	switch l.Match {
+	case lib.PathMatchExact:
+		return "= "
+	case lib.PathMatchRegex:
+		return "~ "
+	}
+	return ""
+}
+
+// Backend is a service port requests are proxied to.
+type Backend struct {
+	Namespace   string
+	ServiceName string
+	ServicePort util.IntOrString
+}
+
+// UpstreamName returns the name of the Upstream holding the addresses of
+// the backend. The parts are joined with underscores, which namespaces,
+// services and port names can't contain, so backends of different
+// namespaces never share an upstream.
+func (b Backend) UpstreamName() string {
+	port := b.ServicePort.StrVal
+	if b.ServicePort.Kind == util.IntstrInt {
+		port = fmt.Sprintf("%d", b.ServicePort.IntVal)
+	}
+	return fmt.Sprintf("%v_%v_%v", b.Namespace, b.ServiceName, port)
+}
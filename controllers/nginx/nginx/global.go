@@ -0,0 +1,232 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	utilerrors "k8s.io/kubernetes/pkg/util/errors"
+	"k8s.io/kubernetes/pkg/util/fielderrors"
+)
+
+// Keys of the global config in the controller ConfigMap.
+const (
+	workerProcessesKey   = "worker-processes"
+	workerConnectionsKey = "worker-connections"
+	keepaliveTimeoutKey  = "keepalive-timeout"
+	sendfileKey          = "sendfile"
+	tcpNopushKey         = "tcp-nopush"
+	tcpNodelayKey        = "tcp-nodelay"
+	gzipKey              = "gzip"
+	gzipTypesKey         = "gzip-types"
+	typesHashMaxSizeKey  = "types-hash-max-size"
+
+	sslRedirectCodeKey       = "ssl-redirect-code"
+	hstsKey                  = "hsts"
+	hstsMaxAgeKey            = "hsts-max-age"
+	hstsIncludeSubdomainsKey = "hsts-include-subdomains"
+	hstsPreloadKey           = "hsts-preload"
+
+	defaultAllowSourceRangeKey = "allow-source-range"
+	defaultDenySourceRangeKey  = "deny-source-range"
+)
+
+// GlobalConfig holds the settings of the main, events and http contexts
+// of nginx.conf, shared by every server.
+type GlobalConfig struct {
+	// WorkerProcesses is a number or "auto".
+	WorkerProcesses   string
+	WorkerConnections int
+	KeepaliveTimeout  time.Duration
+	Sendfile          bool
+	TCPNopush         bool
+	TCPNodelay        bool
+	Gzip              bool
+	// GzipTypes are the MIME types compressed in addition to text/html.
+	GzipTypes        []string
+	TypesHashMaxSize int
+
+	// SSLRedirectCode is the status of redirects from plain http to TLS,
+	// 301 or 308.
+	SSLRedirectCode int
+	// HSTS adds a Strict-Transport-Security header to the responses of TLS
+	// servers.
+	HSTS                  bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// AllowSourceRange and DenySourceRange are the IPs and CIDRs of clients
+	// let through or rejected by servers of Ingresses without their own.
+	AllowSourceRange []string
+	DenySourceRange  []string
+}
+
+// DefaultGlobalConfig returns the settings used for keys missing from the
+// controller ConfigMap.
+func DefaultGlobalConfig() GlobalConfig {
+	return GlobalConfig{
+		WorkerProcesses:   "auto",
+		WorkerConnections: 1024,
+		KeepaliveTimeout:  65 * time.Second,
+		Sendfile:          true,
+		TCPNopush:         true,
+		TCPNodelay:        true,
+		Gzip:              true,
+		GzipTypes:         []string{"application/javascript", "application/json", "application/xml", "text/css", "text/plain", "text/xml"},
+		TypesHashMaxSize:  2048,
+		SSLRedirectCode:   301,
+		HSTSMaxAge:        182 * 24 * time.Hour,
+	}
+}
+
+// KeepaliveTimeoutSeconds returns the keepalive timeout in whole seconds.
+func (g GlobalConfig) KeepaliveTimeoutSeconds() int64 {
+	return int64(g.KeepaliveTimeout / time.Second)
+}
+
+// HSTSHeader returns the value of the Strict-Transport-Security header.
+func (g GlobalConfig) HSTSHeader() string {
+	h := fmt.Sprintf("max-age=%d", int64(g.HSTSMaxAge/time.Second))
+	if g.HSTSIncludeSubdomains {
+		h += "; includeSubDomains"
+	}
+	if g.HSTSPreload {
+		h += "; preload"
+	}
+	return h
+}
+
+// ParseGlobalConfig overrides defaults with the settings in the data of
+// the controller ConfigMap. Unknown keys and invalid values are rejected,
+// and all of them are reported in the returned error.
+func ParseGlobalConfig(data map[string]string, defaults GlobalConfig) (GlobalConfig, error) {
+	g := defaults
+	allErrs := fielderrors.ValidationErrorList{}
+	keys := []string{}
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.TrimSpace(data[k])
+		var err *fielderrors.ValidationError
+		switch k {
+		case workerProcessesKey:
+			if n, convErr := strconv.Atoi(v); v != "auto" && (convErr != nil || n < 1) {
+				err = fielderrors.NewFieldInvalid(k, v, `must be "auto" or a positive number`)
+			} else {
+				g.WorkerProcesses = v
+			}
+		case workerConnectionsKey:
+			g.WorkerConnections, err = parsePositiveInt(k, v)
+		case typesHashMaxSizeKey:
+			g.TypesHashMaxSize, err = parsePositiveInt(k, v)
+		case keepaliveTimeoutKey:
+			g.KeepaliveTimeout, err = parseSeconds(k, v)
+		case hstsMaxAgeKey:
+			g.HSTSMaxAge, err = parseSeconds(k, v)
+		case sendfileKey:
+			g.Sendfile, err = parseBool(k, v)
+		case tcpNopushKey:
+			g.TCPNopush, err = parseBool(k, v)
+		case tcpNodelayKey:
+			g.TCPNodelay, err = parseBool(k, v)
+		case gzipKey:
+			g.Gzip, err = parseBool(k, v)
+		case hstsKey:
+			g.HSTS, err = parseBool(k, v)
+		case hstsIncludeSubdomainsKey:
+			g.HSTSIncludeSubdomains, err = parseBool(k, v)
+		case hstsPreloadKey:
+			g.HSTSPreload, err = parseBool(k, v)
+		case sslRedirectCodeKey:
+			if v != "301" && v != "308" {
+				err = fielderrors.NewFieldValueNotSupported(k, v, []string{"301", "308"})
+			} else {
+				g.SSLRedirectCode, _ = strconv.Atoi(v)
+			}
+		case defaultAllowSourceRangeKey:
+			g.AllowSourceRange, err = parseCIDRs(k, v)
+		case defaultDenySourceRangeKey:
+			g.DenySourceRange, err = parseCIDRs(k, v)
+		case gzipTypesKey:
+			g.GzipTypes = strings.Fields(strings.Replace(v, ",", " ", -1))
+			for _, t := range g.GzipTypes {
+				if strings.Count(t, "/") != 1 {
+					err = fielderrors.NewFieldInvalid(k, t, "must be a MIME type")
+					break
+				}
+			}
+		default:
+			err = fielderrors.NewFieldInvalid(k, v, "unknown key")
+		}
+		if err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+	if len(allErrs) != 0 {
+		return defaults, fmt.Errorf("invalid global config: %v", utilerrors.NewAggregate(allErrs))
+	}
+	return g, nil
+}
+
+func parsePositiveInt(key, v string) (int, *fielderrors.ValidationError) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fielderrors.NewFieldInvalid(key, v, "must be a positive number")
+	}
+	return n, nil
+}
+
+func parseSeconds(key, v string) (time.Duration, *fielderrors.ValidationError) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || d%time.Second != 0 {
+		return 0, fielderrors.NewFieldInvalid(key, v, "must be a duration in whole seconds, eg: 65s")
+	}
+	return d, nil
+}
+
+func parseBool(key, v string) (bool, *fielderrors.ValidationError) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fielderrors.NewFieldInvalid(key, v, "must be true or false")
+	}
+	return b, nil
+}
+
+// parseCIDRs parses a list of IPs and CIDRs separated by commas. An empty
+// list returns an empty, rather than nil, slice.
+func parseCIDRs(key, v string) ([]string, *fielderrors.ValidationError) {
+	cidrs := []string{}
+	if strings.TrimSpace(v) == "" {
+		return cidrs, nil
+	}
+	for _, cidr := range strings.Split(v, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return nil, fielderrors.NewFieldInvalid(key, cidr, "must be an IP or CIDR")
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
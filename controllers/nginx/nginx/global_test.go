@@ -0,0 +1,95 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGlobalConfig(t *testing.T) {
+	defaults := DefaultGlobalConfig()
+	custom := defaults
+	custom.WorkerProcesses = "4"
+	custom.KeepaliveTimeout = 30 * time.Second
+	custom.Gzip = false
+	custom.GzipTypes = []string{"text/css", "application/json"}
+	custom.TypesHashMaxSize = 4096
+	custom.SSLRedirectCode = 308
+	custom.HSTS = true
+	custom.HSTSMaxAge = time.Hour
+	custom.AllowSourceRange = []string{"10.0.0.0/8", "fd00::1"}
+	custom.DenySourceRange = []string{}
+
+	testCases := []struct {
+		desc     string
+		data     map[string]string
+		valid    bool
+		expected GlobalConfig
+	}{
+		{
+			desc:     "empty",
+			valid:    true,
+			expected: defaults,
+		},
+		{
+			desc: "overrides",
+			data: map[string]string{
+				"worker-processes":    "4",
+				"keepalive-timeout":   "30s",
+				"gzip":                "false",
+				"gzip-types":          "text/css, application/json",
+				"types-hash-max-size": " 4096 ",
+				"ssl-redirect-code":   "308",
+				"hsts":                "true",
+				"hsts-max-age":        "1h",
+				"allow-source-range":  "10.0.0.0/8, fd00::1",
+				"deny-source-range":   "",
+			},
+			valid:    true,
+			expected: custom,
+		},
+		{
+			desc: "invalid values",
+			data: map[string]string{
+				"worker-processes":   "0",
+				"worker-connections": "lots",
+				"keepalive-timeout":  "1.5s",
+				"sendfile":           "yes please",
+				"gzip-types":         "css",
+				"ssl-redirect-code":  "302",
+				"allow-source-range": "10.0.0.0/33",
+			},
+			expected: defaults,
+		},
+		{
+			desc:     "unknown key",
+			data:     map[string]string{"worker-proceses": "4"},
+			expected: defaults,
+		},
+	}
+	for _, tc := range testCases {
+		g, err := ParseGlobalConfig(tc.data, defaults)
+		if (err == nil) != tc.valid {
+			t.Errorf("%v: expected valid %v, got error %v", tc.desc, tc.valid, err)
+		}
+		if !reflect.DeepEqual(g, tc.expected) {
+			t.Errorf("%v: expected %+v, got %+v", tc.desc, tc.expected, g)
+		}
+	}
+}
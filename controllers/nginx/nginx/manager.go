@@ -0,0 +1,140 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// Validator checks a candidate config before it goes live.
+type Validator interface {
+	Validate(path string) error
+}
+
+// Reloader makes nginx serve the config at path.
+type Reloader interface {
+	Reload(path string) error
+}
+
+// Manager swaps rendered configs into place. Candidates are written to a
+// staging path and validated first, so a bad config never reaches the live
+// path, and the last config that nginx accepted is kept to roll back to.
+type Manager struct {
+	// ConfigPath is the live config nginx runs with.
+	ConfigPath string
+	// StagingPath is where candidate configs are validated.
+	StagingPath string
+	Validator   Validator
+	Reloader    Reloader
+
+	// lastGood is the last config that passed validation and reload.
+	lastGood []byte
+	// lastRejected is the hash of the last config that failed validation
+	// or reload, and rejectedErr the error it failed with.
+	lastRejected *[sha256.Size]byte
+	rejectedErr  error
+	// retry is set by RetryRejected to try the rejected config again.
+	retry bool
+}
+
+// RejectedError is returned by Apply for a config that failed validation
+// or reload.
+type RejectedError struct {
+	Err error
+	// Repeated is true if the config was already rejected by an earlier
+	// Apply. Unless it was retried, nginx was left untouched.
+	Repeated bool
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+// Apply validates conf and reloads nginx with it. It's a no-op if conf is
+// the last known good config. If validation fails the live config isn't
+// touched. If the reload fails the last known good config is restored and
+// reloaded. Either way the config is remembered as rejected, and applying
+// it again returns the same error without validating or reloading it, until
+// RetryRejected is called.
+func (m *Manager) Apply(conf []byte) error {
+	retry := m.retry
+	m.retry = false
+	if m.lastGood != nil && bytes.Equal(conf, m.lastGood) {
+		glog.V(4).Infof("Config unchanged, skipping reload")
+		return nil
+	}
+	hash := sha256.Sum256(conf)
+	if m.lastRejected != nil && *m.lastRejected == hash && !retry {
+		glog.V(4).Infof("Config was already rejected, skipping validation")
+		return &RejectedError{Err: m.rejectedErr, Repeated: true}
+	}
+	if err := WriteFileAtomic(m.StagingPath, conf, 0644); err != nil {
+		return err
+	}
+	if err := m.Validator.Validate(m.StagingPath); err != nil {
+		return m.reject(hash, fmt.Errorf("rejected invalid config: %v", err))
+	}
+	if err := os.Rename(m.StagingPath, m.ConfigPath); err != nil {
+		return err
+	}
+	if err := m.Reloader.Reload(m.ConfigPath); err != nil {
+		return m.reject(hash, m.rollback(err))
+	}
+	m.lastGood = conf
+	m.lastRejected, m.rejectedErr = nil, nil
+	return nil
+}
+
+// reject remembers the config with the given hash as rejected with err.
+func (m *Manager) reject(hash [sha256.Size]byte, err error) error {
+	repeated := m.lastRejected != nil && *m.lastRejected == hash
+	m.lastRejected, m.rejectedErr = &hash, err
+	return &RejectedError{Err: err, Repeated: repeated}
+}
+
+// RetryRejected makes the next Apply validate and reload a config even if
+// it was rejected before, since some failures are transient: a DNS lookup
+// during validation, or nginx failing to start.
+func (m *Manager) RetryRejected() {
+	m.retry = true
+}
+
+// rollback restores the last known good config after the new one failed
+// to reload with reloadErr.
+func (m *Manager) rollback(reloadErr error) error {
+	if m.lastGood == nil {
+		return fmt.Errorf("reload failed and there's no good config to roll back to: %v", reloadErr)
+	}
+	glog.Errorf("Reload failed, rolling back to the last good config: %v", reloadErr)
+	if err := WriteFileAtomic(m.ConfigPath, m.lastGood, 0644); err != nil {
+		return fmt.Errorf("reload failed: %v, and rollback failed: %v", reloadErr, err)
+	}
+	if err := m.Reloader.Reload(m.ConfigPath); err != nil {
+		return fmt.Errorf("reload failed: %v, and reloading the rolled back config failed: %v", reloadErr, err)
+	}
+	return fmt.Errorf("reload failed, rolled back to the last good config: %v", reloadErr)
+}
+
+// LastGood returns the last config nginx accepted, nil if there isn't one.
+func (m *Manager) LastGood() []byte {
+	return m.lastGood
+}
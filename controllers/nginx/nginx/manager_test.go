@@ -0,0 +1,141 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeValidator rejects configs whose contents are in bad, and counts the
+// configs it validated.
+type fakeValidator struct {
+	bad       map[string]bool
+	validated int
+}
+
+func (v *fakeValidator) Validate(path string) error {
+	v.validated++
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if v.bad[string(b)] {
+		return fmt.Errorf("invalid config %q", string(b))
+	}
+	return nil
+}
+
+// fakeReloader fails to reload configs whose contents are in bad, and
+// records every config it reloaded.
+type fakeReloader struct {
+	bad      map[string]bool
+	reloaded []string
+}
+
+func (r *fakeReloader) Reload(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r.reloaded = append(r.reloaded, string(b))
+	if r.bad[string(b)] {
+		return fmt.Errorf("failed to reload %q", string(b))
+	}
+	return nil
+}
+
+func TestManagerApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	validator := &fakeValidator{bad: map[string]bool{"invalid": true}}
+	reloader := &fakeReloader{bad: map[string]bool{"unreloadable": true}}
+	m := &Manager{
+		ConfigPath:  filepath.Join(dir, "nginx.conf"),
+		StagingPath: filepath.Join(dir, "nginx.conf.staging"),
+		Validator:   validator,
+		Reloader:    reloader,
+	}
+	rejected := func(err error, repeated bool) bool {
+		r, ok := err.(*RejectedError)
+		return ok && r.Repeated == repeated
+	}
+	live := func() string {
+		b, _ := ioutil.ReadFile(m.ConfigPath)
+		return string(b)
+	}
+
+	if err := m.Apply([]byte("good")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if live() != "good" || string(m.LastGood()) != "good" {
+		t.Errorf("expected good config to go live, got %q", live())
+	}
+
+	if err := m.Apply([]byte("invalid")); !rejected(err, false) {
+		t.Errorf("expected invalid config to be rejected, got %v", err)
+	}
+	if err := m.Apply([]byte("invalid")); !rejected(err, true) || validator.validated != 2 {
+		t.Errorf("expected rejected config to skip validation, got %v and %d validations", err, validator.validated)
+	}
+	if live() != "good" || len(reloader.reloaded) != 1 {
+		t.Errorf("expected invalid config to never go live, got %q and reloads %v", live(), reloader.reloaded)
+	}
+	m.RetryRejected()
+	if err := m.Apply([]byte("invalid")); !rejected(err, true) || validator.validated != 3 {
+		t.Errorf("expected a retried config to be validated again, got %v and %d validations", err, validator.validated)
+	}
+	validator.bad["transient"] = true
+	if err := m.Apply([]byte("transient")); !rejected(err, false) {
+		t.Errorf("expected transient failure to be rejected, got %v", err)
+	}
+	delete(validator.bad, "transient")
+	if err := m.Apply([]byte("transient")); !rejected(err, true) {
+		t.Errorf("expected rejected config to stay rejected until retried, got %v", err)
+	}
+	m.RetryRejected()
+	if err := m.Apply([]byte("transient")); err != nil || live() != "transient" {
+		t.Errorf("expected retried config to go live once valid, got %v and %q", err, live())
+	}
+	if err := m.Apply([]byte("good")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Apply([]byte("unreloadable")); !rejected(err, false) {
+		t.Errorf("expected failed reload to be rejected, got %v", err)
+	}
+	if err := m.Apply([]byte("unreloadable")); !rejected(err, true) {
+		t.Errorf("expected failed reload to be rejected without reloading, got %v", err)
+	}
+	if live() != "good" || string(m.LastGood()) != "good" {
+		t.Errorf("expected rollback to the good config, got %q", live())
+	}
+	if expected := []string{"good", "transient", "good", "unreloadable", "good"}; fmt.Sprint(reloader.reloaded) != fmt.Sprint(expected) {
+		t.Errorf("expected reloads %v, got %v", expected, reloader.reloaded)
+	}
+
+	if err := m.Apply([]byte("good")); err != nil || len(reloader.reloaded) != 5 {
+		t.Errorf("expected unchanged config to skip the reload, got %v and reloads %v", err, reloader.reloaded)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// Process starts and reloads the nginx daemon.
+type Process struct {
+	Binary  string
+	started bool
+}
+
+// Reload starts nginx with the config at path the first time it's called,
+// and asks the running daemon to reload its config after that.
+func (p *Process) Reload(path string) error {
+	args := []string{"-c", path}
+	if p.started {
+		args = append(args, "-s", "reload")
+	}
+	if err := run(p.Binary, args...); err != nil {
+		return err
+	}
+	p.started = true
+	return nil
+}
+
+// CommandValidator validates configs with nginx -t.
+type CommandValidator struct {
+	Binary string
+}
+
+// Validate runs nginx -t against the config at path.
+func (v *CommandValidator) Validate(path string) error {
+	return run(v.Binary, "-t", "-c", path)
+}
+
+func run(binary string, args ...string) error {
+	glog.Infof("Running %v %v", binary, args)
+	if out, err := exec.Command(binary, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %v failed: %v\n%v", binary, args, err, string(out))
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of path
+// and renames it over path, so readers never see a partial file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
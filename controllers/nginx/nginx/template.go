@@ -0,0 +1,252 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bprashanth/Ingress/lib"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+// confTemplate is the nginx.conf rendered from a Config.
+const confTemplate = `
+worker_processes {{.WorkerProcesses}};
+events {
+  worker_connections {{.WorkerConnections}};
+}
+http {
+  sendfile {{onOff .Sendfile}};
+  tcp_nopush {{onOff .TCPNopush}};
+  tcp_nodelay {{onOff .TCPNodelay}};
+  keepalive_timeout {{.KeepaliveTimeoutSeconds}}s;
+  types_hash_max_size {{.TypesHashMaxSize}};
+  gzip {{onOff .Gzip}};{{if and .Gzip .GzipTypes}}
+  gzip_types {{join .GzipTypes " "}};{{end}}
+{{if .RateLimits}}
+  limit_req_status 429;
+  limit_conn_status 429;{{end}}{{range $limit := .RateLimits}}{{if $limit.Whitelist}}
+  geo ${{$limit.ID}}_whitelisted {
+    default 0;{{range $cidr := $limit.Whitelist}}
+    {{$cidr}} 1;{{end}}
+  }
+  map ${{$limit.ID}}_whitelisted {{$limit.Key}} {
+    0 $binary_remote_addr;
+    1 "";
+  }{{end}}{{if $limit.RPS}}
+  limit_req_zone {{$limit.Key}} zone={{$limit.ID}}_req:10m rate={{$limit.RPS}}r/s;{{end}}{{if $limit.Connections}}
+  limit_conn_zone {{$limit.Key}} zone={{$limit.ID}}_conn:10m;{{end}}{{end}}{{range $upstream := .Upstreams}}
+  upstream {{$upstream.Name}} {
+{{range $s := $upstream.Servers}}    server {{$s.Address}}:{{$s.Port}};
+{{else}}    # No ready endpoints, fail requests with a 502.
+    server 127.0.0.1:1 down;
+{{end}}  }{{end}}
+{{range $server := .Servers}}
+  server {
+    listen {{$server.Port}}{{if $server.HTTP2}} http2{{end}};
+    server_name {{$server.Name}};
+{{if $server.Redirect}}    return {{$server.Redirect.Code}} {{$server.Redirect.URL}};
+{{end}}{{if $server.SSLCert}}
+    ssl on;
+    ssl_certificate {{$server.SSLCert}};
+    ssl_certificate_key {{$server.SSLKey}};{{with $server.ClientAuth}}
+    ssl_client_certificate {{.CA}};
+    ssl_verify_client {{.Verify}};
+    ssl_verify_depth {{.Depth}};{{end}}{{if $.HSTS}}
+    add_header Strict-Transport-Security "{{$.HSTSHeader}}" always;{{end}}
+{{end}}{{with $server.SourceRange}}{{range $cidr := .Deny}}
+    deny {{$cidr}};{{end}}{{range $cidr := .Allow}}
+    allow {{$cidr}};{{end}}{{if .Allow}}
+    deny all;{{end}}{{end}}{{with $server.ExternalAuth}}
+    location = {{.Path}} {
+      internal;
+      proxy_pass {{.URL}};
+      proxy_pass_request_body off;
+      proxy_set_header Content-Length "";
+      proxy_set_header X-Original-URI $request_uri;
+      proxy_set_header X-Original-Method $request_method;{{if .RequestHeaders}}
+      proxy_pass_request_headers off;{{range $h := .RequestHeaders}}
+      proxy_set_header {{$h}} $http_{{headerVar $h}};{{end}}{{end}}
+    }{{end}}{{range $loc := $server.Locations}}
+    location {{$loc.Modifier}}{{quote $loc.Path}} {
+      {{$loc.Pass}} {{$loc.URL}};{{$p := $loc.DirectivePrefix}}
+      {{$p}}_set_header Host $host;
+      {{$p}}_set_header X-Real-IP $remote_addr;
+      {{$p}}_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      {{$p}}_set_header X-Forwarded-Proto $scheme;{{with $loc.UpstreamTLS}}
+      {{$p}}_ssl_name {{.ServerName}};
+      {{$p}}_ssl_server_name {{onOff .SNI}};{{if .TrustedCA}}
+      {{$p}}_ssl_verify on;
+      {{$p}}_ssl_trusted_certificate {{.TrustedCA}};{{end}}{{end}}{{with $server.ExternalAuth}}
+      auth_request {{.Path}};{{range $h := .ResponseHeaders}}
+      auth_request_set $auth_{{headerVar $h}} $upstream_http_{{headerVar $h}};
+      {{$p}}_set_header {{$h}} $auth_{{headerVar $h}};{{end}}{{if .SignIn}}
+      error_page 401 =302 {{.SignInURL}};{{end}}{{end}}{{with $loc.BasicAuth}}
+      auth_basic {{quote .Realm}};
+      auth_basic_user_file {{.UserFile}};{{end}}{{with $loc.RateLimit}}{{if .RPS}}
+      limit_req zone={{.ID}}_req{{if .Burst}} burst={{.Burst}}{{end}}{{if .NoDelay}} nodelay{{end}};{{end}}{{if .Connections}}
+      limit_conn {{.ID}}_conn {{.Connections}};{{end}}{{end}}{{with $server.ClientAuth}}{{if .SubjectHeader}}
+      {{$p}}_set_header {{.SubjectHeader}} $ssl_client_s_dn;{{end}}{{end}}{{with $loc.Proxy}}{{if .ConnectTimeout}}
+      {{$p}}_connect_timeout {{seconds .ConnectTimeout}}s;{{end}}{{if .ReadTimeout}}
+      {{$p}}_read_timeout {{seconds .ReadTimeout}}s;{{end}}{{if .ClientMaxBodySize}}
+      client_max_body_size {{.ClientMaxBodySize}};{{end}}{{if and .Buffering (not $loc.IsGRPC)}}
+      proxy_buffering {{onOff (deref .Buffering)}};{{end}}{{end}}
+    }{{end}}
+  }{{end}}
+}`
+
+// funcMap holds the helper functions available to templates, in addition
+// to the text/template builtins and the methods of the Config types:
+//   - join LIST SEP joins a list of strings with SEP.
+//   - quote STRING double quotes a string for use as an nginx argument.
+//   - hasPrefix STRING PREFIX and hasSuffix STRING SUFFIX wrap the strings
+//     package functions of the same name.
+//   - lower STRING lower cases a string.
+//   - onOff BOOL returns "on" or "off".
+//   - seconds DURATION returns a time.Duration in whole seconds.
+//   - deref POINTER returns the bool a *bool points to.
+//   - headerVar HEADER returns the suffix of the nginx variables holding a
+//     header, eg: x_user for X-User in $http_x_user.
+var funcMap = template.FuncMap{
+	"join":      strings.Join,
+	"quote":     quote,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"lower":     strings.ToLower,
+	"onOff":     onOff,
+	"seconds":   seconds,
+	"deref":     deref,
+	"headerVar": headerVar,
+}
+
+func headerVar(h string) string {
+	return strings.Replace(strings.ToLower(h), "-", "_", -1)
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+func deref(b *bool) bool {
+	return *b
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// quote returns s as a double quoted nginx string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Template renders a Config into nginx.conf.
+type Template struct {
+	tmpl *template.Template
+}
+
+// DefaultTemplate is the template compiled into the controller.
+var DefaultTemplate = mustTemplate("nginx.conf", confTemplate)
+
+// NewTemplate parses text as a template for nginx.conf. Templates that
+// parse but fail to render a sample config are rejected too, so mistakes
+// like a misspelt field surface when the template is loaded rather than
+// on the next sync.
+func NewTemplate(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(funcMap).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{tmpl}
+	if _, err := t.Render(sampleConfig()); err != nil {
+		return nil, fmt.Errorf("failed to render sample config: %v", err)
+	}
+	return t, nil
+}
+
+func mustTemplate(name, text string) *Template {
+	t, err := NewTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the template against the given config.
+func (t *Template) Render(cfg *Config) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, cfg); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Render executes the default template against the given config.
+func Render(cfg *Config) ([]byte, error) {
+	return DefaultTemplate.Render(cfg)
+}
+
+// sampleConfig returns a config that exercises every field of the model,
+// used to validate templates.
+func sampleConfig() *Config {
+	backend := Backend{Namespace: "default", ServiceName: "sample", ServicePort: util.NewIntOrStringFromInt(80)}
+	global := DefaultGlobalConfig()
+	global.HSTS = true
+	buffering := false
+	limit := &RateLimit{ID: "limit_sample", RPS: 10, Burst: 20, NoDelay: true, Connections: 5, Whitelist: []string{"10.0.0.0/8"}}
+	auth := &BasicAuth{Realm: "Sample", UserFile: "/etc/nginx/auth/sample.htpasswd"}
+	tls := &UpstreamTLS{ServerName: "sample.default.svc", SNI: true, TrustedCA: "/etc/nginx/ssl/sample-ca.crt"}
+	proxy := ProxySettings{ConnectTimeout: 5 * time.Second, ReadTimeout: time.Minute, ClientMaxBodySize: "8m", Buffering: &buffering}
+	return &Config{
+		GlobalConfig: global,
+		RateLimits:   []*RateLimit{limit},
+		Upstreams: []Upstream{
+			{Name: backend.UpstreamName(), Servers: []UpstreamServer{{Address: "10.0.0.1", Port: 8080}}},
+			{Name: "default_empty_80"},
+		},
+		Servers: []Server{
+			{
+				Name: "sample.com", Port: 443, HTTP2: true, SSLCert: "/etc/nginx/ssl/sample.crt", SSLKey: "/etc/nginx/ssl/sample.key",
+				SourceRange: &SourceRange{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.1"}},
+				ExternalAuth: &ExternalAuth{
+					Path:            externalAuthPath,
+					URL:             "http://auth.default.svc/check",
+					RequestHeaders:  []string{"Cookie"},
+					ResponseHeaders: []string{"X-User"},
+					SignIn:          "https://sample.com/signin",
+				},
+				ClientAuth: &ClientAuth{CA: "/etc/nginx/ssl/sample-ca.crt", Verify: "on", Depth: 1, SubjectHeader: "X-Client-Subject"},
+				Locations: []Location{
+					{Path: "/exact", Match: lib.PathMatchExact, Backend: backend, Proxy: proxy},
+					{Path: "/", Match: lib.PathMatchPrefix, Backend: backend, RateLimit: limit, BasicAuth: auth},
+					{Path: `\.png$`, Match: lib.PathMatchRegex, Backend: backend},
+					{Path: "/secure", Backend: backend, Protocol: ProtocolHTTPS, UpstreamTLS: tls},
+					{Path: "/grpc", Backend: backend, Protocol: ProtocolGRPCS, UpstreamTLS: tls, Proxy: proxy},
+				},
+			},
+			{Name: "_", Port: 80, Locations: []Location{{Path: "/", Match: lib.PathMatchPrefix, Backend: backend}}},
+			{Name: "sample.com", Port: 80, Redirect: &Redirect{Code: 301, Port: 443}},
+		},
+	}
+}
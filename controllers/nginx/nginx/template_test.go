@@ -0,0 +1,143 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/util"
+)
+
+func ExampleRender() {
+	cfg := &Config{
+		GlobalConfig: DefaultGlobalConfig(),
+		Upstreams: []Upstream{
+			{Name: "default_catchall_443", Servers: []UpstreamServer{{Address: "10.1.0.1", Port: 8443}, {Address: "10.1.0.2", Port: 8443}}},
+			{Name: "default_foosvc_https"},
+		},
+		Servers: []Server{
+			{
+				Name: "_", Port: 443, SSLCert: "/etc/nginx/wildcard.crt", SSLKey: "/etc/nginx/wildcard.key",
+				Locations: []Location{{Path: "/", Backend: Backend{Namespace: "default", ServiceName: "catchall", ServicePort: util.NewIntOrStringFromInt(443)}}},
+			},
+			{
+				Name: "foo", Port: 80,
+				Locations: []Location{{Path: "/", Backend: Backend{Namespace: "default", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromString("https")}}},
+			},
+		},
+	}
+	b, _ := Render(cfg)
+	fmt.Println(string(b))
+	// Output:
+	// worker_processes auto;
+	// events {
+	//   worker_connections 1024;
+	// }
+	// http {
+	//   sendfile on;
+	//   tcp_nopush on;
+	//   tcp_nodelay on;
+	//   keepalive_timeout 65s;
+	//   types_hash_max_size 2048;
+	//   gzip on;
+	//   gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+	//
+	//   upstream default_catchall_443 {
+	//     server 10.1.0.1:8443;
+	//     server 10.1.0.2:8443;
+	//   }
+	//   upstream default_foosvc_https {
+	//     # No ready endpoints, fail requests with a 502.
+	//     server 127.0.0.1:1 down;
+	//   }
+	//
+	//   server {
+	//     listen 443;
+	//     server_name _;
+	//
+	//     ssl on;
+	//     ssl_certificate /etc/nginx/wildcard.crt;
+	//     ssl_certificate_key /etc/nginx/wildcard.key;
+	//
+	//     location "/" {
+	//       proxy_pass http://default_catchall_443;
+	//       proxy_set_header Host $host;
+	//       proxy_set_header X-Real-IP $remote_addr;
+	//       proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+	//       proxy_set_header X-Forwarded-Proto $scheme;
+	//     }
+	//   }
+	//   server {
+	//     listen 80;
+	//     server_name foo;
+	//
+	//     location "/" {
+	//       proxy_pass http://default_foosvc_https;
+	//       proxy_set_header Host $host;
+	//       proxy_set_header X-Real-IP $remote_addr;
+	//       proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+	//       proxy_set_header X-Forwarded-Proto $scheme;
+	//     }
+	//   }
+	// }
+}
+
+func TestNewTemplate(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		text     string
+		valid    bool
+		expected string
+	}{
+		{
+			desc:     "helpers",
+			text:     `{{range .Servers}}server_name {{quote .Name}};{{if hasPrefix .SSLCert "/etc"}} {{lower "SSL"}}{{end}}` + "\n{{end}}",
+			valid:    true,
+			expected: "server_name \"foo.com\"; ssl\nserver_name \"_\";\n",
+		},
+		{
+			desc: "syntax error",
+			text: `{{range .Servers}}`,
+		},
+		{
+			desc: "unknown field",
+			text: `{{range .Servers}}{{.Hostname}}{{end}}`,
+		},
+		{
+			desc: "unknown function",
+			text: `{{upper .WorkerConnections}}`,
+		},
+	}
+	cfg := &Config{Servers: []Server{{Name: "foo.com", SSLCert: "/etc/nginx/ssl/foo.crt"}, {Name: "_"}}}
+	for _, tc := range testCases {
+		tmpl, err := NewTemplate(tc.desc, tc.text)
+		if (err == nil) != tc.valid {
+			t.Errorf("%v: expected valid %v, got error %v", tc.desc, tc.valid, err)
+			continue
+		}
+		if !tc.valid {
+			continue
+		}
+		b, err := tmpl.Render(cfg)
+		if err != nil {
+			t.Errorf("%v: unexpected error rendering: %v", tc.desc, err)
+		} else if string(b) != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.desc, tc.expected, string(b))
+		}
+	}
+}
@@ -0,0 +1,571 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bprashanth/Ingress/lib"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/util"
+	utilerrors "k8s.io/kubernetes/pkg/util/errors"
+)
+
+// ServiceGetter fetches a service by namespace and name.
+type ServiceGetter func(namespace, name string) (*api.Service, error)
+
+// EndpointsGetter fetches the endpoints of a service by namespace and name.
+type EndpointsGetter func(namespace, name string) (*api.Endpoints, error)
+
+// CertWriter writes the keypair in the named secret to disk, and returns
+// the paths of the cert and key.
+type CertWriter func(namespace, secret string) (crt, key string, err error)
+
+// httpPort is the port of plain http servers, and of redirects to TLS.
+const httpPort = 80
+
+// HtpasswdWriter writes the htpasswd file in the named secret to disk, and
+// returns its path.
+type HtpasswdWriter func(namespace, secret string) (string, error)
+
+// CAWriter writes the CA bundle in the named secret to disk, and returns
+// its path.
+type CAWriter func(namespace, secret string) (string, error)
+
+// Translator converts Ingresses into a Config.
+type Translator struct {
+	Global        GlobalConfig
+	GetService    ServiceGetter
+	GetEndpoints  EndpointsGetter
+	WriteCert     CertWriter
+	WriteCA       CAWriter
+	WriteHtpasswd HtpasswdWriter
+}
+
+// Translate builds a Config from the routing model of every Ingress. The
+// oldest Ingress to claim a host and port wins, as in lib.FindConflicts,
+// and so does the first to define an upstream.
+// Servers that can't be translated, and warnings from the routing model,
+// are returned as errors but don't stop the rest of the translation.
+func (t *Translator) Translate(ings []extensions.Ingress) (*Config, []error) {
+	cfg := &Config{GlobalConfig: t.Global, Upstreams: []Upstream{}, RateLimits: []*RateLimit{}, Servers: []Server{}}
+	errs := []error{}
+	sorted := append([]extensions.Ingress{}, ings...)
+	lib.SortByAge(sorted)
+	owners := map[string]string{}
+	claimed := []claimedServer{}
+	upstreams := map[string]Upstream{}
+	upstreamOwners := map[string]string{}
+	for i := range sorted {
+		ing := &sorted[i]
+		ingName := ing.Namespace + "/" + ing.Name
+		model, err := lib.BuildRoutingModel(ing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("skipping Ingress %v: %v", ingName, err))
+			continue
+		}
+		for _, w := range model.Warnings {
+			errs = append(errs, fmt.Errorf("Ingress %v: %v", ingName, w))
+		}
+		settings, settingsErrs := parseSettings(ing.Annotations)
+		for _, err := range settingsErrs {
+			errs = append(errs, fmt.Errorf("Ingress %v: %v", ingName, err))
+		}
+		basicAuth, err := t.basicAuth(ing.Namespace, settings)
+		if err != nil {
+			settings.accessErr = err
+		}
+		servers := []translatedServer{}
+		for _, s := range model.Servers {
+			server, ups, err := t.translateServer(ing.Namespace, s, settings, basicAuth)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("skipping %v:%v of Ingress %v: %v", s.Host, s.Port, ingName, err))
+				continue
+			}
+			servers = append(servers, translatedServer{server, ups})
+		}
+		// The plain http server of a host with client certs would serve it
+		// without them, so it's always redirected.
+		clientAuth := settings.clientAuth != nil || settings.clientAuthErr != nil
+		if clientAuth && !settings.sslRedirect {
+			errs = append(errs, fmt.Errorf("Ingress %v: ignoring %v, hosts with %v are always redirected to TLS", ingName, sslRedirectKey, authTLSSecretKey))
+		}
+		if settings.sslRedirect || clientAuth {
+			servers = t.redirectToTLS(model.Servers, servers)
+		}
+		if settings.clientAuth != nil && !hasTLS(model.Servers) {
+			errs = append(errs, fmt.Errorf("Ingress %v: %v has no effect without a TLS server", ingName, authTLSSecretKey))
+		}
+		for _, ts := range servers {
+			key := fmt.Sprintf("%v:%v", ts.server.Name, ts.server.Port)
+			if owner, ok := owners[key]; ok {
+				errs = append(errs, fmt.Errorf("Ingress %v: %v is already served by Ingress %v", ingName, key, owner))
+				continue
+			}
+			owners[key] = ingName
+			claimed = append(claimed, claimedServer{ts, ingName})
+		}
+	}
+	claimed, http2Errs := plainHTTP2(claimed)
+	errs = append(errs, http2Errs...)
+	for _, c := range claimed {
+		cfg.Servers = append(cfg.Servers, c.server)
+		for _, loc := range c.server.Locations {
+			if loc.RateLimit != nil {
+				cfg.RateLimits = append(cfg.RateLimits, loc.RateLimit)
+			}
+		}
+		for _, u := range c.ups {
+			// Ingresses that disagree on service-upstream define the same
+			// upstream with different addresses.
+			if prev, ok := upstreams[u.Name]; ok {
+				if !reflect.DeepEqual(prev.Servers, u.Servers) {
+					errs = append(errs, fmt.Errorf("Ingress %v: upstream %v is already defined by Ingress %v with other addresses, using those", c.owner, u.Name, upstreamOwners[u.Name]))
+				}
+				continue
+			}
+			upstreams[u.Name] = u
+			upstreamOwners[u.Name] = c.owner
+		}
+	}
+	for _, u := range upstreams {
+		cfg.Upstreams = append(cfg.Upstreams, u)
+	}
+	sort.Sort(byName(cfg.Upstreams))
+	return cfg, errs
+}
+
+// ingressSettings are the nginx annotations of an Ingress.
+type ingressSettings struct {
+	useVIP      bool
+	sslRedirect bool
+	proxy       ProxySettings
+	backend     backendSettings
+	clientAuth  *clientAuthSettings
+	rateLimit   *RateLimit
+	basicAuth   *basicAuthSettings
+	extAuth     *ExternalAuth
+	// allowSourceRange and denySourceRange are nil unless annotated.
+	allowSourceRange []string
+	denySourceRange  []string
+	// clientAuthErr fails the TLS servers of an Ingress with invalid
+	// client cert settings.
+	clientAuthErr error
+	// accessErr fails every server of an Ingress whose access restrictions
+	// are invalid, rather than serving it unrestricted.
+	accessErr error
+}
+
+// parseSettings returns the settings in the annotations of an Ingress, and
+// the errors of those that are invalid.
+func parseSettings(annotations map[string]string) (ingressSettings, []error) {
+	a := ingAnnotations(annotations)
+	s := ingressSettings{}
+	errs := []error{}
+	var err error
+	if s.useVIP, err = a.serviceUpstream(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.sslRedirect, err = a.sslRedirect(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.proxy, err = a.proxySettings(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.backend, err = a.backendSettings(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.rateLimit, err = a.rateLimit(); err != nil {
+		errs = append(errs, err)
+	}
+	s.clientAuth, s.clientAuthErr = a.clientAuthSettings()
+	accessErrs := []error{}
+	if s.basicAuth, err = a.basicAuthSettings(); err != nil {
+		accessErrs = append(accessErrs, err)
+	}
+	if s.extAuth, err = a.externalAuth(); err != nil {
+		accessErrs = append(accessErrs, err)
+	}
+	if s.allowSourceRange, s.denySourceRange, err = a.sourceRange(); err != nil {
+		accessErrs = append(accessErrs, err)
+	}
+	if len(accessErrs) != 0 {
+		s.accessErr = utilerrors.NewAggregate(accessErrs)
+	}
+	return s, errs
+}
+
+// sourceRange returns the client restrictions of an Ingress, falling back
+// to the global ones for lists it doesn't annotate.
+func (t *Translator) sourceRange(settings ingressSettings) *SourceRange {
+	r := SourceRange{Allow: t.Global.AllowSourceRange, Deny: t.Global.DenySourceRange}
+	if settings.allowSourceRange != nil {
+		r.Allow = settings.allowSourceRange
+	}
+	if settings.denySourceRange != nil {
+		r.Deny = settings.denySourceRange
+	}
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return nil
+	}
+	return &r
+}
+
+// basicAuth writes the htpasswd file of an Ingress with basic auth, nil
+// for an Ingress without.
+func (t *Translator) basicAuth(namespace string, settings ingressSettings) (*BasicAuth, error) {
+	if settings.basicAuth == nil || settings.accessErr != nil {
+		return nil, nil
+	}
+	path, err := t.WriteHtpasswd(namespace, settings.basicAuth.secret)
+	if err != nil {
+		return nil, fmt.Errorf("htpasswd: %v", err)
+	}
+	return &BasicAuth{Realm: settings.basicAuth.realm, UserFile: path}, nil
+}
+
+// rateLimitID returns a name for the limit zones of a location that's
+// valid in nginx variables. The hash keeps it unique, since the host is
+// only part of the name and may differ in characters that are replaced.
+func rateLimitID(server Server, loc Location) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%v:%v %v%v", server.Name, server.Port, loc.Modifier(), loc.Path)
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, server.Name)
+	return fmt.Sprintf("limit_%v_%08x", name, h.Sum32())
+}
+
+func hasTLS(servers []lib.Server) bool {
+	for _, s := range servers {
+		if s.TLSSecret != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// translatedServer is a Server and the upstreams its locations proxy to.
+type translatedServer struct {
+	server Server
+	ups    []Upstream
+}
+
+// claimedServer is a translated server and the Ingress that owns its host
+// and port.
+type claimedServer struct {
+	translatedServer
+	owner string
+}
+
+// plainHTTP2 enables HTTP/2 on plain servers whose locations are all gRPC.
+// The options of listen apply to every server on a port, and a plain
+// listener with HTTP/2 can't serve HTTP/1 clients, so those servers are
+// skipped if they share their port with any other plain server.
+func plainHTTP2(claimed []claimedServer) ([]claimedServer, []error) {
+	http1Ports := map[int]bool{}
+	for _, c := range claimed {
+		if c.server.SSLCert == "" && !c.server.grpcOnly() {
+			http1Ports[c.server.Port] = true
+		}
+	}
+	kept := []claimedServer{}
+	errs := []error{}
+	for _, c := range claimed {
+		if c.server.SSLCert == "" && c.server.grpcOnly() {
+			if http1Ports[c.server.Port] {
+				errs = append(errs, fmt.Errorf("skipping %v:%v of Ingress %v: plain gRPC needs HTTP/2 on port %v, which is shared with HTTP/1 servers", c.server.Name, c.server.Port, c.owner, c.server.Port))
+				continue
+			}
+			c.server.HTTP2 = true
+		}
+		kept = append(kept, c)
+	}
+	return kept, errs
+}
+
+// redirectToTLS turns the plain http server of every host that also has a
+// TLS server in the routing model into a redirect to the TLS server,
+// adding one for hosts that don't have a plain http server. Hosts served on
+// several TLS ports are redirected to the lowest. A TLS server that failed
+// to translate is still redirected to, rather than falling back to plain
+// http.
+func (t *Translator) redirectToTLS(model []lib.Server, servers []translatedServer) []translatedServer {
+	tlsPorts := map[string]int{}
+	for _, s := range model {
+		if s.TLSSecret == "" || s.Port == httpPort {
+			continue
+		}
+		if p, ok := tlsPorts[s.Host]; !ok || s.Port < p {
+			tlsPorts[s.Host] = s.Port
+		}
+	}
+	if len(tlsPorts) == 0 {
+		return servers
+	}
+	redirected := map[string]bool{}
+	for i := range servers {
+		s := &servers[i].server
+		port, ok := tlsPorts[s.Name]
+		if !ok || s.Port != httpPort || s.SSLCert != "" {
+			continue
+		}
+		s.Locations = nil
+		s.Redirect = &Redirect{Code: t.Global.SSLRedirectCode, Port: port}
+		servers[i].ups = nil
+		redirected[s.Name] = true
+	}
+	for host, port := range tlsPorts {
+		if redirected[host] {
+			continue
+		}
+		servers = append(servers, translatedServer{server: Server{
+			Name:     host,
+			Port:     httpPort,
+			Redirect: &Redirect{Code: t.Global.SSLRedirectCode, Port: port},
+		}})
+	}
+	sort.Sort(byServer(servers))
+	return servers
+}
+
+// translateServer converts a server of the routing model, writing its cert
+// to disk, and returns the upstreams its locations proxy to. A route to a
+// service, or service port, that doesn't exist fails the server.
+func (t *Translator) translateServer(namespace string, s lib.Server, settings ingressSettings, basicAuth *BasicAuth) (Server, []Upstream, error) {
+	server := Server{Name: s.Host, Port: s.Port}
+	if server.Name == "" {
+		server.Name = "_"
+	}
+	if settings.accessErr != nil {
+		return server, nil, settings.accessErr
+	}
+	server.ExternalAuth = settings.extAuth
+	server.SourceRange = t.sourceRange(settings)
+	ups := []Upstream{}
+	for _, r := range s.Routes {
+		// Paths of rules aren't validated by the apiserver, and are quoted
+		// when rendered, which keeps braces in regexes inert.
+		if err := lib.ValidatePathSyntax(r.Path, r.Match); err != nil {
+			return server, nil, fmt.Errorf("path %q: %v", r.Path, err)
+		}
+		backend := Backend{
+			Namespace:   namespace,
+			ServiceName: r.Backend.ServiceName,
+			ServicePort: r.Backend.ServicePort,
+		}
+		u, portName, err := t.upstream(backend, settings.useVIP)
+		if err != nil {
+			return server, nil, fmt.Errorf("backend of %v: %v", r.Path, err)
+		}
+		ups = append(ups, u)
+		loc := Location{
+			Path:      r.Path,
+			Match:     r.Match,
+			Backend:   backend,
+			Proxy:     settings.proxy,
+			BasicAuth: basicAuth,
+			Protocol:  settings.backend.protocol,
+		}
+		if loc.Protocol == "" {
+			loc.Protocol = protocolForPort(portName)
+		}
+		if settings.rateLimit != nil {
+			limit := *settings.rateLimit
+			limit.ID = rateLimitID(server, loc)
+			loc.RateLimit = &limit
+		}
+		if loc.Protocol == ProtocolHTTPS || loc.Protocol == ProtocolGRPCS {
+			if loc.UpstreamTLS, err = t.upstreamTLS(backend, settings.backend); err != nil {
+				return server, nil, fmt.Errorf("backend of %v: %v", r.Path, err)
+			}
+		}
+		server.Locations = append(server.Locations, loc)
+	}
+	if len(server.Locations) == 0 {
+		return server, nil, fmt.Errorf("no backends")
+	}
+	sort.Sort(byPrecedence(server.Locations))
+	if s.TLSSecret != "" {
+		crt, key, err := t.WriteCert(namespace, s.TLSSecret)
+		if err != nil {
+			return server, nil, err
+		}
+		server.SSLCert, server.SSLKey = crt, key
+		if settings.clientAuthErr != nil {
+			return server, nil, settings.clientAuthErr
+		}
+		if c := settings.clientAuth; c != nil {
+			ca, err := t.WriteCA(namespace, c.caSecret)
+			if err != nil {
+				return server, nil, fmt.Errorf("client cert CA: %v", err)
+			}
+			server.ClientAuth = &ClientAuth{CA: ca, Verify: c.verify, Depth: c.depth, SubjectHeader: c.subjectHeader}
+		}
+	}
+	// gRPC clients need HTTP/2 to nginx, which TLS listeners negotiate
+	// with HTTP/1 clients through ALPN. Plain listeners are left to
+	// plainHTTP2, since they can only speak one of them.
+	if server.SSLCert != "" {
+		for _, loc := range server.Locations {
+			server.HTTP2 = server.HTTP2 || loc.clientHTTP2()
+		}
+	}
+	return server, ups, nil
+}
+
+// upstream returns the addresses of the given backend: the ready endpoints
+// of its service port, or the cluster IP of the service if useVIP is set.
+// It also returns the name of the service port.
+func (t *Translator) upstream(b Backend, useVIP bool) (Upstream, string, error) {
+	u := Upstream{Name: b.UpstreamName(), Servers: []UpstreamServer{}}
+	svc, err := t.GetService(b.Namespace, b.ServiceName)
+	if err != nil {
+		return u, "", err
+	}
+	port, err := servicePort(svc, b.ServicePort)
+	if err != nil {
+		return u, "", err
+	}
+	if useVIP {
+		if !api.IsServiceIPSet(svc) {
+			return u, "", fmt.Errorf("service %v/%v has no cluster IP", svc.Namespace, svc.Name)
+		}
+		u.Servers = append(u.Servers, UpstreamServer{Address: svc.Spec.ClusterIP, Port: port.Port})
+		return u, port.Name, nil
+	}
+	ep, err := t.GetEndpoints(b.Namespace, b.ServiceName)
+	if errors.IsNotFound(err) {
+		// The endpoints controller hasn't caught up with a new service.
+		return u, port.Name, nil
+	} else if err != nil {
+		return u, "", err
+	}
+	for _, subset := range ep.Subsets {
+		for _, p := range subset.Ports {
+			if p.Name != port.Name {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				u.Servers = append(u.Servers, UpstreamServer{Address: addr.IP, Port: p.Port})
+			}
+		}
+	}
+	sort.Sort(byAddress(u.Servers))
+	return u, port.Name, nil
+}
+
+// upstreamTLS returns the TLS settings of a backend. Backends are verified
+// against, and by default named after, the cluster DNS name of their
+// service. Asking for verification without a CA fails the backend rather
+// than silently skipping verification.
+func (t *Translator) upstreamTLS(b Backend, settings backendSettings) (*UpstreamTLS, error) {
+	tls := &UpstreamTLS{ServerName: settings.sslName, SNI: settings.sni}
+	if tls.ServerName == "" {
+		tls.ServerName = fmt.Sprintf("%v.%v.svc", b.ServiceName, b.Namespace)
+	}
+	if !settings.verify {
+		return tls, nil
+	}
+	if settings.caSecret == "" {
+		return nil, fmt.Errorf("%v requires %v", proxySSLVerifyKey, proxySSLCASecretKey)
+	}
+	ca, err := t.WriteCA(b.Namespace, settings.caSecret)
+	if err != nil {
+		return nil, err
+	}
+	tls.TrustedCA = ca
+	return tls, nil
+}
+
+// servicePort returns the port of the service matching the number or name
+// of an Ingress backend.
+func servicePort(svc *api.Service, port util.IntOrString) (*api.ServicePort, error) {
+	for i := range svc.Spec.Ports {
+		p := &svc.Spec.Ports[i]
+		if (port.Kind == util.IntstrInt && p.Port == port.IntVal) || (port.Kind == util.IntstrString && p.Name == port.StrVal) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("service %v/%v has no port %v", svc.Namespace, svc.Name, port.String())
+}
+
+// byPrecedence orders locations the way nginx matches them: exact matches,
+// then prefixes from longest to shortest, then regexes. Nginx picks the
+// longest prefix wherever it's declared, so that order is only for
+// readability, but it tries regexes in order and the first match wins, so
+// longer, usually more specific, regexes go first.
+type byPrecedence []Location
+
+func (l byPrecedence) Len() int      { return len(l) }
+func (l byPrecedence) Swap(a, b int) { l[a], l[b] = l[b], l[a] }
+func (l byPrecedence) Less(a, b int) bool {
+	if ra, rb := matchRank(l[a].Match), matchRank(l[b].Match); ra != rb {
+		return ra < rb
+	}
+	if len(l[a].Path) != len(l[b].Path) {
+		return len(l[a].Path) > len(l[b].Path)
+	}
+	return l[a].Path < l[b].Path
+}
+
+func matchRank(m lib.PathMatchType) int {
+	switch m {
+	case lib.PathMatchExact:
+		return 0
+	case lib.PathMatchRegex:
+		return 2
+	}
+	return 1
+}
+
+type byServer []translatedServer
+
+func (s byServer) Len() int      { return len(s) }
+func (s byServer) Swap(a, b int) { s[a], s[b] = s[b], s[a] }
+func (s byServer) Less(a, b int) bool {
+	if s[a].server.Name != s[b].server.Name {
+		return s[a].server.Name < s[b].server.Name
+	}
+	return s[a].server.Port < s[b].server.Port
+}
+
+type byName []Upstream
+
+func (u byName) Len() int           { return len(u) }
+func (u byName) Swap(a, b int)      { u[a], u[b] = u[b], u[a] }
+func (u byName) Less(a, b int) bool { return u[a].Name < u[b].Name }
+
+type byAddress []UpstreamServer
+
+func (s byAddress) Len() int      { return len(s) }
+func (s byAddress) Swap(a, b int) { s[a], s[b] = s[b], s[a] }
+func (s byAddress) Less(a, b int) bool {
+	if s[a].Address != s[b].Address {
+		return s[a].Address < s[b].Address
+	}
+	return s[a].Port < s[b].Port
+}
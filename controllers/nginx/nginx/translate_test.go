@@ -0,0 +1,1525 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+const receiversKey = "Ingress.receivers"
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func newBackend(name string, port int) *extensions.IngressBackend {
+	return &extensions.IngressBackend{ServiceName: name, ServicePort: util.NewIntOrStringFromInt(port)}
+}
+
+func newPath(path string, backend *extensions.IngressBackend) extensions.HTTPIngressPath {
+	return extensions.HTTPIngressPath{Path: path, Backend: *backend}
+}
+
+func newRule(host string, paths ...extensions.HTTPIngressPath) extensions.IngressRule {
+	return extensions.IngressRule{
+		Host:             host,
+		IngressRuleValue: extensions.IngressRuleValue{HTTP: &extensions.HTTPIngressRuleValue{Paths: paths}},
+	}
+}
+
+// newTranslator returns a Translator that knows about the given services
+// in the default namespace. Each service exposes ports 80 as "http", 8080
+// as "alt", 443 as "https" and 50051 as "grpc-api", with endpoints on 8000,
+// 9000, 8443 and 50051 at the ready IPs in endpoints.
+func newTranslator(services []string, endpoints map[string][]string) *Translator {
+	known := map[string]bool{}
+	for _, s := range services {
+		known[s] = true
+	}
+	return &Translator{
+		Global: DefaultGlobalConfig(),
+		GetService: func(namespace, name string) (*api.Service, error) {
+			if !known[name] {
+				return nil, errors.NewNotFound("service", name)
+			}
+			return &api.Service{
+				ObjectMeta: api.ObjectMeta{Name: name, Namespace: namespace},
+				Spec: api.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []api.ServicePort{
+						{Name: "http", Port: 80},
+						{Name: "alt", Port: 8080},
+						{Name: "https", Port: 443},
+						{Name: "grpc-api", Port: 50051},
+					},
+				},
+			}, nil
+		},
+		GetEndpoints: func(namespace, name string) (*api.Endpoints, error) {
+			ips, ok := endpoints[name]
+			if !ok {
+				return nil, errors.NewNotFound("endpoints", name)
+			}
+			subset := api.EndpointSubset{
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.9.9.9"}},
+				Ports: []api.EndpointPort{
+					{Name: "http", Port: 8000},
+					{Name: "alt", Port: 9000},
+					{Name: "https", Port: 8443},
+					{Name: "grpc-api", Port: 50051},
+				},
+			}
+			for _, ip := range ips {
+				subset.Addresses = append(subset.Addresses, api.EndpointAddress{IP: ip})
+			}
+			return &api.Endpoints{ObjectMeta: api.ObjectMeta{Name: name, Namespace: namespace}, Subsets: []api.EndpointSubset{subset}}, nil
+		},
+		WriteCert: func(namespace, secret string) (string, string, error) {
+			return fmt.Sprintf("/ssl/%v-%v.crt", namespace, secret), fmt.Sprintf("/ssl/%v-%v.key", namespace, secret), nil
+		},
+		WriteCA: func(namespace, secret string) (string, error) {
+			return fmt.Sprintf("/ssl/%v-%v-ca.crt", namespace, secret), nil
+		},
+		WriteHtpasswd: func(namespace, secret string) (string, error) {
+			if secret == "missing" {
+				return "", errors.NewNotFound("secret", secret)
+			}
+			return fmt.Sprintf("/auth/%v-%v.htpasswd", namespace, secret), nil
+		},
+	}
+}
+
+// trimConf strips blank lines and indentation so expected configs can be
+// written compactly.
+func trimConf(conf string) string {
+	lines := []string{}
+	for _, l := range strings.Split(conf, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestTranslate(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		ings      []extensions.Ingress
+		services  []string
+		endpoints map[string][]string
+		hsts      bool
+		// denySourceRange is the global default of the deny list.
+		denySourceRange []string
+		errs            int
+		expected        string
+	}{
+		{
+			desc: "default backend only",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "ing", Namespace: "default"},
+					Spec:       extensions.IngressSpec{Backend: newBackend("defsvc", 80)},
+				},
+			},
+			services:  []string{"defsvc"},
+			endpoints: map[string][]string{"defsvc": {"10.1.0.2", "10.1.0.1"}},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_defsvc_80 {
+    server 10.1.0.1:8000;
+    server 10.1.0.2:8000;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "hosts with several paths and a tls receiver",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "ing",
+						Namespace:   "default",
+						Annotations: map[string]string{receiversKey: `[{"host":"foo.com","port":443,"cert":"foosecret"}]`},
+					},
+					Spec: extensions.IngressSpec{
+						Backend: newBackend("defsvc", 80),
+						Rules: []extensions.IngressRule{
+							newRule("foo.com", newPath("/api", newBackend("apisvc", 8080))),
+						},
+					},
+				},
+			},
+			services:  []string{"defsvc", "apisvc"},
+			endpoints: map[string][]string{"defsvc": {"10.1.0.1"}, "apisvc": {"10.2.0.1"}},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_apisvc_8080 {
+    server 10.2.0.1:9000;
+  }
+  upstream default_defsvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    return 301 https://$host$request_uri;
+  }
+  server {
+    listen 443;
+    server_name foo.com;
+    ssl on;
+    ssl_certificate /ssl/default-foosecret.crt;
+    ssl_certificate_key /ssl/default-foosecret.key;
+    location "/api" {
+      proxy_pass http://default_apisvc_8080;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "missing service, missing port and a host claimed by an older Ingress",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "b", Namespace: "default", CreationTimestamp: unversioned.Unix(1, 0)},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("othersvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{Name: "a", Namespace: "default", CreationTimestamp: unversioned.Unix(2, 0)},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("foosvc", 80))),
+						newRule("bar.com", newPath("/", newBackend("missing", 80))),
+						newRule("baz.com", newPath("/", newBackend("foosvc", 81))),
+					}},
+				},
+			},
+			services:  []string{"foosvc", "othersvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}, "othersvc": {"10.2.0.1"}},
+			errs:      3,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_othersvc_80 {
+    server 10.2.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location "/" {
+      proxy_pass http://default_othersvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "named port without ready endpoints",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "ing", Namespace: "default"},
+					Spec: extensions.IngressSpec{Backend: &extensions.IngressBackend{
+						ServiceName: "defsvc",
+						ServicePort: util.NewIntOrStringFromString("alt"),
+					}},
+				},
+			},
+			services: []string{"defsvc"},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_defsvc_alt {
+    # No ready endpoints, fail requests with a 502.
+    server 127.0.0.1:1 down;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_alt;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "service upstream annotation, and an Ingress disagreeing on it",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "a", Namespace: "default", CreationTimestamp: unversioned.Unix(2, 0)},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("defsvc", 8080))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:              "ing",
+						Namespace:         "default",
+						CreationTimestamp: unversioned.Unix(1, 0),
+						Annotations:       map[string]string{serviceUpstreamKey: "true"},
+					},
+					Spec: extensions.IngressSpec{Backend: newBackend("defsvc", 8080)},
+				},
+			},
+			services:  []string{"defsvc"},
+			endpoints: map[string][]string{"defsvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_defsvc_8080 {
+    server 10.0.0.1:8080;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_8080;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location "/" {
+      proxy_pass http://default_defsvc_8080;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "proxy annotations with an invalid value",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "ing",
+						Namespace: "default",
+						Annotations: map[string]string{
+							proxyConnectTimeoutKey: "10s",
+							proxyReadTimeoutKey:    "soon",
+							clientMaxBodySizeKey:   "16m",
+							proxyBufferingKey:      "false",
+						},
+					},
+					Spec: extensions.IngressSpec{Backend: newBackend("defsvc", 80)},
+				},
+			},
+			services:  []string{"defsvc"},
+			endpoints: map[string][]string{"defsvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_defsvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      proxy_connect_timeout 10s;
+      client_max_body_size 16m;
+      proxy_buffering off;
+    }
+  }
+}`,
+		},
+		{
+			desc: "redirects to a tls receiver without rules, opt out and hsts",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "a",
+						Namespace:   "default",
+						Annotations: map[string]string{receiversKey: `[{"host":"foo.com","port":8443,"cert":"foosecret"}]`},
+					},
+					Spec: extensions.IngressSpec{Backend: newBackend("defsvc", 80)},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "b",
+						Namespace: "default",
+						Annotations: map[string]string{
+							receiversKey:   `[{"host":"bar.com","port":443,"cert":"barsecret"}]`,
+							sslRedirectKey: "false",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("barsvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"defsvc", "barsvc"},
+			endpoints: map[string][]string{"defsvc": {"10.1.0.1"}, "barsvc": {"10.2.0.1"}},
+			hsts:      true,
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_barsvc_80 {
+    server 10.2.0.1:8000;
+  }
+  upstream default_defsvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    return 301 https://$host:8443$request_uri;
+  }
+  server {
+    listen 8443;
+    server_name foo.com;
+    ssl on;
+    ssl_certificate /ssl/default-foosecret.crt;
+    ssl_certificate_key /ssl/default-foosecret.key;
+    add_header Strict-Transport-Security "max-age=15724800" always;
+    location "/" {
+      proxy_pass http://default_defsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name bar.com;
+    location "/" {
+      proxy_pass http://default_barsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 443;
+    server_name bar.com;
+    ssl on;
+    ssl_certificate /ssl/default-barsecret.crt;
+    ssl_certificate_key /ssl/default-barsecret.key;
+    add_header Strict-Transport-Security "max-age=15724800" always;
+    location "/" {
+      proxy_pass http://default_barsvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "backend protocols from port names and annotations",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "a",
+						Namespace:   "default",
+						Annotations: map[string]string{receiversKey: `[{"host":"foo.com","port":443,"cert":"foosecret"}]`},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com",
+							newPath("/api", newBackend("apisvc", 443)),
+							newPath("/rpc", newBackend("apisvc", 50051)),
+						),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "b",
+						Namespace: "default",
+						Annotations: map[string]string{
+							backendProtocolKey: "https",
+							proxySSLVerifyKey:  "true",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("apisvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "c",
+						Namespace: "default",
+						Annotations: map[string]string{
+							receiversKey:          `[{"host":"baz.com","port":443,"cert":"bazsecret"}]`,
+							backendProtocolKey:    "GRPCS",
+							proxySSLVerifyKey:     "true",
+							proxySSLCASecretKey:   "apica",
+							proxySSLNameKey:       "api.internal",
+							proxySSLServerNameKey: "true",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("baz.com", newPath("/", newBackend("apisvc", 8080))),
+					}},
+				},
+			},
+			services:  []string{"apisvc"},
+			endpoints: map[string][]string{"apisvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_apisvc_443 {
+    server 10.1.0.1:8443;
+  }
+  upstream default_apisvc_50051 {
+    server 10.1.0.1:50051;
+  }
+  upstream default_apisvc_8080 {
+    server 10.1.0.1:9000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    return 301 https://$host$request_uri;
+  }
+  server {
+    listen 443 http2;
+    server_name foo.com;
+    ssl on;
+    ssl_certificate /ssl/default-foosecret.crt;
+    ssl_certificate_key /ssl/default-foosecret.key;
+    location "/api" {
+      proxy_pass https://default_apisvc_443;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      proxy_ssl_name apisvc.default.svc;
+      proxy_ssl_server_name off;
+    }
+    location "/rpc" {
+      grpc_pass grpc://default_apisvc_50051;
+      grpc_set_header Host $host;
+      grpc_set_header X-Real-IP $remote_addr;
+      grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      grpc_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name baz.com;
+    return 301 https://$host$request_uri;
+  }
+  server {
+    listen 443 http2;
+    server_name baz.com;
+    ssl on;
+    ssl_certificate /ssl/default-bazsecret.crt;
+    ssl_certificate_key /ssl/default-bazsecret.key;
+    location "/" {
+      grpc_pass grpcs://default_apisvc_8080;
+      grpc_set_header Host $host;
+      grpc_set_header X-Real-IP $remote_addr;
+      grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      grpc_set_header X-Forwarded-Proto $scheme;
+      grpc_ssl_name api.internal;
+      grpc_ssl_server_name on;
+      grpc_ssl_verify on;
+      grpc_ssl_trusted_certificate /ssl/default-apica-ca.crt;
+    }
+  }
+}`,
+		},
+		{
+			desc: "client cert authentication",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "a",
+						Namespace: "default",
+						Annotations: map[string]string{
+							receiversKey:            `[{"host":"foo.com","port":443,"cert":"foosecret"}]`,
+							sslRedirectKey:          "false",
+							authTLSSecretKey:        "clientca",
+							authTLSVerifyClientKey:  "optional",
+							authTLSVerifyDepthKey:   "2",
+							authTLSSubjectHeaderKey: "X-Client-Subject",
+						},
+					},
+					Spec: extensions.IngressSpec{Backend: newBackend("foosvc", 80)},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "b",
+						Namespace: "default",
+						Annotations: map[string]string{
+							receiversKey:          `[{"host":"bar.com","port":443,"cert":"barsecret"}]`,
+							authTLSSecretKey:      "clientca",
+							authTLSVerifyDepthKey: "deep",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("barsvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"foosvc", "barsvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}, "barsvc": {"10.2.0.1"}},
+			errs:      3,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name _;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    return 301 https://$host$request_uri;
+  }
+  server {
+    listen 443;
+    server_name foo.com;
+    ssl on;
+    ssl_certificate /ssl/default-foosecret.crt;
+    ssl_certificate_key /ssl/default-foosecret.key;
+    ssl_client_certificate /ssl/default-clientca-ca.crt;
+    ssl_verify_client optional;
+    ssl_verify_depth 2;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      proxy_set_header X-Client-Subject $ssl_client_s_dn;
+    }
+  }
+  server {
+    listen 80;
+    server_name bar.com;
+    return 301 https://$host$request_uri;
+  }
+}`,
+		},
+		{
+			desc: "rate and connection limits",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "a",
+						Namespace: "default",
+						Annotations: map[string]string{
+							limitRPSKey:         "10",
+							limitBurstKey:       "20",
+							limitNoDelayKey:     "true",
+							limitConnectionsKey: "5",
+							limitWhitelistKey:   "10.0.0.0/8, 192.168.1.1, nope",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com",
+							newPath("/", newBackend("foosvc", 80)),
+							newPath("/api", newBackend("foosvc", 8080)),
+						),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "b",
+						Namespace:   "default",
+						Annotations: map[string]string{limitRPSKey: "5", limitBurstKey: "10", limitConnectionsKey: "2"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"foosvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  limit_req_status 429;
+  limit_conn_status 429;
+  geo $limit_foo_com_4f127825_whitelisted {
+    default 0;
+    10.0.0.0/8 1;
+    192.168.1.1 1;
+  }
+  map $limit_foo_com_4f127825_whitelisted $limit_foo_com_4f127825_key {
+    0 $binary_remote_addr;
+    1 "";
+  }
+  limit_req_zone $limit_foo_com_4f127825_key zone=limit_foo_com_4f127825_req:10m rate=10r/s;
+  limit_conn_zone $limit_foo_com_4f127825_key zone=limit_foo_com_4f127825_conn:10m;
+  geo $limit_foo_com_4f71b06f_whitelisted {
+    default 0;
+    10.0.0.0/8 1;
+    192.168.1.1 1;
+  }
+  map $limit_foo_com_4f71b06f_whitelisted $limit_foo_com_4f71b06f_key {
+    0 $binary_remote_addr;
+    1 "";
+  }
+  limit_req_zone $limit_foo_com_4f71b06f_key zone=limit_foo_com_4f71b06f_req:10m rate=10r/s;
+  limit_conn_zone $limit_foo_com_4f71b06f_key zone=limit_foo_com_4f71b06f_conn:10m;
+  limit_req_zone $binary_remote_addr zone=limit_bar_com_9e13f014_req:10m rate=5r/s;
+  limit_conn_zone $binary_remote_addr zone=limit_bar_com_9e13f014_conn:10m;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  upstream default_foosvc_8080 {
+    server 10.1.0.1:9000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location "/api" {
+      proxy_pass http://default_foosvc_8080;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      limit_req zone=limit_foo_com_4f127825_req burst=20 nodelay;
+      limit_conn limit_foo_com_4f127825_conn 5;
+    }
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      limit_req zone=limit_foo_com_4f71b06f_req burst=20 nodelay;
+      limit_conn limit_foo_com_4f71b06f_conn 5;
+    }
+  }
+  server {
+    listen 80;
+    server_name bar.com;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      limit_req zone=limit_bar_com_9e13f014_req burst=10;
+      limit_conn limit_bar_com_9e13f014_conn 2;
+    }
+  }
+}`,
+		},
+		{
+			desc: "basic auth",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "a",
+						Namespace: "default",
+						Annotations: map[string]string{
+							authSecretKey: "users",
+							authRealmKey:  `Internal "tools"`,
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "b",
+						Namespace:   "default",
+						Annotations: map[string]string{authSecretKey: "missing"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "c",
+						Namespace: "default",
+						Annotations: map[string]string{
+							authSecretKey: "users",
+							authRealmKey:  "Hi $remote_user",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("baz.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"foosvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}},
+			errs:      2,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      auth_basic "Internal \"tools\"";
+      auth_basic_user_file /auth/default-users.htpasswd;
+    }
+  }
+}`,
+		},
+		{
+			desc: "external auth",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "a",
+						Namespace: "default",
+						Annotations: map[string]string{
+							authURLKey:             "http://auth.default.svc/check",
+							authRequestHeadersKey:  "Cookie, Authorization",
+							authResponseHeadersKey: "X-Auth-User",
+							authSigninKey:          "https://login.foo.com/start?app=foo",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "b",
+						Namespace:   "default",
+						Annotations: map[string]string{authURLKey: "ftp://auth.default.svc/check"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:      "c",
+						Namespace: "default",
+						Annotations: map[string]string{
+							authURLKey:    "http://auth.default.svc/check",
+							authSigninKey: "https://login.foo.com/start?user=$remote_user",
+						},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("baz.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"foosvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}},
+			errs:      2,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location = /_external-auth {
+      internal;
+      proxy_pass http://auth.default.svc/check;
+      proxy_pass_request_body off;
+      proxy_set_header Content-Length "";
+      proxy_set_header X-Original-URI $request_uri;
+      proxy_set_header X-Original-Method $request_method;
+      proxy_pass_request_headers off;
+      proxy_set_header Cookie $http_cookie;
+      proxy_set_header Authorization $http_authorization;
+    }
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+      auth_request /_external-auth;
+      auth_request_set $auth_x_auth_user $upstream_http_x_auth_user;
+      proxy_set_header X-Auth-User $auth_x_auth_user;
+      error_page 401 =302 https://login.foo.com/start?app=foo&rd=$scheme://$host$request_uri;
+    }
+  }
+}`,
+		},
+		{
+			desc: "source ranges",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "a",
+						Namespace:   "default",
+						Annotations: map[string]string{allowSourceRangeKey: "10.0.0.0/8, 172.16.0.1"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "b",
+						Namespace:   "default",
+						Annotations: map[string]string{denySourceRangeKey: ""},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("bar.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "c",
+						Namespace:   "default",
+						Annotations: map[string]string{allowSourceRangeKey: "10.0.0.300"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("baz.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{Name: "d", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("qux.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+			},
+			services:        []string{"foosvc"},
+			endpoints:       map[string][]string{"foosvc": {"10.1.0.1"}},
+			denySourceRange: []string{"192.0.2.0/24"},
+			errs:            1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    deny 192.0.2.0/24;
+    allow 10.0.0.0/8;
+    allow 172.16.0.1;
+    deny all;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name bar.com;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name qux.com;
+    deny 192.0.2.0/24;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "hostile path",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "a", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("evil.com", newPath("/x { return 200 pwned; } location /y", newBackend("foosvc", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{Name: "b", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/", newBackend("foosvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"foosvc"},
+			endpoints: map[string][]string{"foosvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_foosvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name foo.com;
+    location "/" {
+      proxy_pass http://default_foosvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "plain gRPC alone on its port",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "a", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("grpc.com", newPath("/", newBackend("apisvc", 50051))),
+					}},
+				},
+			},
+			services:  []string{"apisvc"},
+			endpoints: map[string][]string{"apisvc": {"10.1.0.1"}},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_apisvc_50051 {
+    server 10.1.0.1:50051;
+  }
+  server {
+    listen 80 http2;
+    server_name grpc.com;
+    location "/" {
+      grpc_pass grpc://default_apisvc_50051;
+      grpc_set_header Host $host;
+      grpc_set_header X-Real-IP $remote_addr;
+      grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      grpc_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "plain HTTP2 backend",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{
+						Name:        "a",
+						Namespace:   "default",
+						Annotations: map[string]string{backendProtocolKey: "HTTP2"},
+					},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("h2c.com", newPath("/", newBackend("apisvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"apisvc"},
+			endpoints: map[string][]string{"apisvc": {"10.1.0.1"}},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_apisvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name h2c.com;
+    location "/" {
+      grpc_pass grpc://default_apisvc_80;
+      grpc_set_header Host $host;
+      grpc_set_header X-Real-IP $remote_addr;
+      grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      grpc_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "plain gRPC sharing its port",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "a", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("grpc.com", newPath("/", newBackend("apisvc", 50051))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{Name: "b", Namespace: "default"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("web.com", newPath("/", newBackend("apisvc", 80))),
+					}},
+				},
+			},
+			services:  []string{"apisvc"},
+			endpoints: map[string][]string{"apisvc": {"10.1.0.1"}},
+			errs:      1,
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream default_apisvc_80 {
+    server 10.1.0.1:8000;
+  }
+  server {
+    listen 80;
+    server_name web.com;
+    location "/" {
+      proxy_pass http://default_apisvc_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+		{
+			desc: "backends whose namespace and service names join the same way",
+			ings: []extensions.Ingress{
+				{
+					ObjectMeta: api.ObjectMeta{Name: "one", Namespace: "a-b"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("one.com", newPath("/", newBackend("c", 80))),
+					}},
+				},
+				{
+					ObjectMeta: api.ObjectMeta{Name: "two", Namespace: "a"},
+					Spec: extensions.IngressSpec{Rules: []extensions.IngressRule{
+						newRule("two.com", newPath("/", newBackend("b-c", 80))),
+					}},
+				},
+			},
+			services:  []string{"c", "b-c"},
+			endpoints: map[string][]string{"c": {"10.1.0.1"}, "b-c": {"10.1.0.2"}},
+			expected: `
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+http {
+  sendfile on;
+  tcp_nopush on;
+  tcp_nodelay on;
+  keepalive_timeout 65s;
+  types_hash_max_size 2048;
+  gzip on;
+  gzip_types application/javascript application/json application/xml text/css text/plain text/xml;
+  upstream a-b_c_80 {
+    server 10.1.0.1:8000;
+  }
+  upstream a_b-c_80 {
+    server 10.1.0.2:8000;
+  }
+  server {
+    listen 80;
+    server_name two.com;
+    location "/" {
+      proxy_pass http://a_b-c_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+  server {
+    listen 80;
+    server_name one.com;
+    location "/" {
+      proxy_pass http://a-b_c_80;
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Proto $scheme;
+    }
+  }
+}`,
+		},
+	}
+	for _, tc := range testCases {
+		translator := newTranslator(tc.services, tc.endpoints)
+		translator.Global.HSTS = tc.hsts
+		translator.Global.DenySourceRange = tc.denySourceRange
+		cfg, errs := translator.Translate(tc.ings)
+		if len(errs) != tc.errs {
+			t.Errorf("%v: expected %d errors, got %v", tc.desc, tc.errs, errs)
+		}
+		conf, err := Render(cfg)
+		if err != nil {
+			t.Errorf("%v: unexpected error rendering: %v", tc.desc, err)
+			continue
+		}
+		if got, expected := trimConf(string(conf)), trimConf(tc.expected); got != expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v", tc.desc, expected, got)
+		}
+	}
+}
+
+// TestLocationsGolden renders Ingresses with overlapping paths and compares
+// the result with testdata/<name>.golden. Run with -update to regenerate
+// the golden files after an intended change.
+func TestLocationsGolden(t *testing.T) {
+	testCases := []struct {
+		name string
+		ing  extensions.Ingress
+		errs int
+	}{
+		{
+			name: "nested-prefixes",
+			ing: extensions.Ingress{
+				ObjectMeta: api.ObjectMeta{Name: "ing", Namespace: "default"},
+				Spec: extensions.IngressSpec{
+					Backend: newBackend("defsvc", 80),
+					Rules: []extensions.IngressRule{
+						newRule("foo.com",
+							newPath("/a", newBackend("asvc", 80)),
+							newPath("/api", newBackend("apisvc", 80)),
+							newPath("/api/v1", newBackend("apisvc", 8080)),
+							newPath("/", newBackend("foosvc", 80)),
+						),
+					},
+				},
+			},
+		},
+		{
+			name: "mixed-matches",
+			ing: extensions.Ingress{
+				ObjectMeta: api.ObjectMeta{
+					Name:      "ing",
+					Namespace: "default",
+					Annotations: map[string]string{receiversKey: `[{"host":"foo.com","port":443,"cert":"foosecret","paths":[
+						{"path":"/api","match":"Exact","serviceName":"apisvc","servicePort":8080},
+						{"path":"\\.png$","match":"Regex","serviceName":"asvc","servicePort":80},
+						{"path":"^/api/v[0-9]+/","match":"Regex","serviceName":"apisvc","servicePort":8080},
+						{"path":"^/v[0-9]{1,2}/","match":"Regex","serviceName":"apisvc","servicePort":8080},
+						{"path":"/api/v1","serviceName":"apisvc","servicePort":80}
+					]}]`},
+				},
+				Spec: extensions.IngressSpec{
+					Rules: []extensions.IngressRule{
+						newRule("foo.com",
+							newPath("/api", newBackend("apisvc", 80)),
+							newPath("/", newBackend("foosvc", 80)),
+						),
+					},
+				},
+			},
+		},
+		{
+			name: "duplicate-paths",
+			ing: extensions.Ingress{
+				ObjectMeta: api.ObjectMeta{Name: "ing", Namespace: "default"},
+				Spec: extensions.IngressSpec{
+					Rules: []extensions.IngressRule{
+						newRule("foo.com", newPath("/api", newBackend("apisvc", 80))),
+						newRule("foo.com",
+							newPath("/api", newBackend("asvc", 80)),
+							newPath("/api/", newBackend("asvc", 80)),
+						),
+					},
+				},
+			},
+			errs: 1,
+		},
+	}
+	services := []string{"defsvc", "foosvc", "asvc", "apisvc"}
+	endpoints := map[string][]string{"defsvc": {"10.1.0.1"}, "foosvc": {"10.2.0.1"}, "asvc": {"10.3.0.1"}, "apisvc": {"10.4.0.1"}}
+	for _, tc := range testCases {
+		cfg, errs := newTranslator(services, endpoints).Translate([]extensions.Ingress{tc.ing})
+		if len(errs) != tc.errs {
+			t.Errorf("%v: expected %d errors, got %v", tc.name, tc.errs, errs)
+		}
+		conf, err := Render(cfg)
+		if err != nil {
+			t.Errorf("%v: unexpected error rendering: %v", tc.name, err)
+			continue
+		}
+		golden := filepath.Join("testdata", tc.name+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, conf, 0644); err != nil {
+				t.Fatalf("%v: failed to update golden file: %v", tc.name, err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("%v: failed to read golden file: %v", tc.name, err)
+			continue
+		}
+		if string(conf) != string(expected) {
+			t.Errorf("%v: expected\n%s\ngot\n%s", tc.name, expected, conf)
+		}
+	}
+}
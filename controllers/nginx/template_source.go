@@ -0,0 +1,75 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/bprashanth/Ingress/lib"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// templatePollPeriod is how often a template file is checked for
+	// changes. Template ConfigMaps are watched instead.
+	templatePollPeriod = 5 * time.Second
+
+	// templateKey is the key of the template in a template ConfigMap.
+	templateKey = "nginx.tmpl"
+)
+
+// templateSource is where a user supplied nginx template is read from.
+type templateSource struct {
+	// desc names the source in logs and template errors.
+	desc string
+	load func() (string, error)
+	// configMap is the ConfigMap holding the template, nil for a file.
+	configMap *configMapRef
+}
+
+// fileTemplate reads the template from a file.
+func fileTemplate(path string) *templateSource {
+	return &templateSource{
+		desc: path,
+		load: func() (string, error) {
+			b, err := ioutil.ReadFile(path)
+			return string(b), err
+		},
+	}
+}
+
+// configMapTemplate reads the template from the templateKey of a ConfigMap.
+func configMapTemplate(c *client.Client, ref *configMapRef) *templateSource {
+	desc := "configmap " + ref.String()
+	return &templateSource{
+		desc:      desc,
+		configMap: ref,
+		load: func() (string, error) {
+			cm, err := lib.GetConfigMap(c, ref.namespace, ref.name)
+			if err != nil {
+				return "", err
+			}
+			text, ok := cm.Data[templateKey]
+			if !ok {
+				return "", fmt.Errorf("%v has no %v key", desc, templateKey)
+			}
+			return text, nil
+		},
+	}
+}
@@ -14,15 +14,32 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+// A small tool to manage the receivers annotated on an Ingress.
+// Usage:
+//
+//	receivers [update] --ing=namespace/name --host=foo.com --port=443 --cert=foosecret [--path=[match:]/foo=foosvc:80,...]
+//	receivers remove --ing=namespace/name --host=foo.com [--port=443]
+//	receivers replace --ing=namespace/name --receivers='[{"host":"foo.com","port":443,"cert":"foosecret"}]'
+//	receivers list [--list-namespace=namespace]
+//	receivers watch [--list-namespace=namespace]
+//	receivers migrate [--list-namespace=namespace]
+//	receivers conflicts [--list-namespace=namespace] [--allow=foo.com:namespace,...]
+//
+// Receivers are stored in Ingress annotations, or in the ConfigMap named by
+// --configmap if it's given.
 package main
 
 import (
-	flag "github.com/spf13/pflag"
+	"encoding/json"
 	"os"
+	"strconv"
 	"strings"
 
+	flag "github.com/spf13/pflag"
+	"k8s.io/kubernetes/pkg/api"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
 	kubectl_util "k8s.io/kubernetes/pkg/kubectl/cmd/util"
+	"k8s.io/kubernetes/pkg/util"
 
 	"github.com/bprashanth/Ingress/lib"
 	"github.com/golang/glog"
@@ -31,26 +48,79 @@ import (
 var (
 	flags = flag.NewFlagSet("", flag.ContinueOnError)
 
-	host    = flags.String("host", "", "Hostname.")
-	port    = flags.Int("port", 0, "Port number.")
-	cert    = flags.String("cert", "", "Name of secret.")
-	ingress = flags.String("ing", "", "Namespace/Name of ingress.")
+	host          = flags.String("host", "", "Hostname.")
+	port          = flags.Int("port", 0, "Port number.")
+	cert          = flags.String("cert", "", "Name of secret.")
+	ingress       = flags.String("ing", "", "Namespace/Name of ingress.")
+	paths         = flags.StringSlice("path", []string{}, "List of path rules of the form [prefix|exact|regex:]path=service:port, used by update.")
+	receivers     = flags.String("receivers", "", "Json list of receivers, used by replace.")
+	listNamespace = flags.String("list-namespace", api.NamespaceAll, "Namespace to list, watch, migrate or check receivers in, used by list, watch, migrate and conflicts. Defaults to all namespaces.")
+	allow         = flags.StringSlice("allow", []string{}, "List of host:namespace pairs, used by conflicts. Only the listed namespaces may own a listed host, otherwise the oldest Ingress wins.")
+	configMap     = flags.String("configmap", "", "Name of a ConfigMap to store receivers in, instead of Ingress annotations.")
 )
 
-func main() {
-	flags.Parse(os.Args)
-	if *port == 0 || *cert == "" || *host == "" || *ingress == "" {
-		glog.Fatalf("Need more information to add receiver.")
-	}
+// conflictFinder is implemented by the receiver stores that can report
+// conflicts.
+type conflictFinder interface {
+	Conflicts(ingNamespace string, policy lib.ConflictPolicy) ([]lib.Conflict, error)
+}
+
+var (
+	_ conflictFinder = &lib.AnnotatedReceivers{}
+	_ conflictFinder = &lib.ConfigMapReceivers{}
+)
+
+// ingressName splits the --ing flag into a name and namespace.
+func ingressName() (string, string) {
 	fullName := strings.Split(*ingress, "/")
 	if len(fullName) != 2 {
-		glog.Fatalf("--ingress should take the form namespace/name.")
+		glog.Fatalf("--ing should take the form namespace/name.")
+	}
+	return fullName[1], fullName[0]
+}
+
+// pathRules parses the --path flag.
+func pathRules() []lib.PathRule {
+	var rules []lib.PathRule
+	matchTypes := map[string]lib.PathMatchType{
+		"prefix": lib.PathMatchPrefix,
+		"exact":  lib.PathMatchExact,
+		"regex":  lib.PathMatchRegex,
+	}
+	for _, p := range *paths {
+		rule := lib.PathRule{}
+		if i := strings.Index(p, ":"); i > 0 && matchTypes[p[:i]] != "" {
+			rule.Match = matchTypes[p[:i]]
+			p = p[i+1:]
+		}
+		i := strings.LastIndex(p, "=")
+		if i < 0 {
+			glog.Fatalf("--path should take the form [match:]path=service:port, got %v.", p)
+		}
+		svcPort := strings.Split(p[i+1:], ":")
+		if len(svcPort) != 2 {
+			glog.Fatalf("--path should take the form [match:]path=service:port, got %v.", p)
+		}
+		rule.Path = p[:i]
+		rule.ServiceName = svcPort[0]
+		if port, err := strconv.Atoi(svcPort[1]); err == nil {
+			rule.ServicePort = util.NewIntOrStringFromInt(port)
+		} else {
+			rule.ServicePort = util.NewIntOrStringFromString(svcPort[1])
+		}
+		rules = append(rules, rule)
 	}
-	ingName := fullName[1]
-	ingNamespace := fullName[0]
-	rec := lib.Receiver{Host: *host, Port: *port, Cert: *cert}
+	return rules
+}
 
+func main() {
 	clientConfig := kubectl_util.DefaultClientConfig(flags)
+	flags.Parse(os.Args)
+	cmd := "update"
+	if flags.NArg() > 1 {
+		cmd = flags.Arg(1)
+	}
+
 	config, err := clientConfig.ClientConfig()
 	if err != nil {
 		glog.Fatalf("error connecting to the client: %v", err)
@@ -59,14 +129,101 @@ func main() {
 	if err != nil {
 		glog.Fatalf("error creating kube client %v", err)
 	}
-
-	ar := lib.AnnotatedReceivers{kubeClient}
-	if err := ar.Update(ingName, ingNamespace, rec); err != nil {
-		glog.Fatalf("%v", err)
+	var store lib.ReceiverStore = &lib.AnnotatedReceivers{Client: kubeClient}
+	if *configMap != "" {
+		store = &lib.ConfigMapReceivers{Client: kubeClient, Name: *configMap}
 	}
-	receivers, err := ar.Get(ingName, ingNamespace)
-	if err != nil {
-		glog.Fatalf("%v", err)
+
+	switch cmd {
+	case "update":
+		if *port == 0 || *cert == "" || *host == "" || *ingress == "" {
+			glog.Fatalf("Need more information to add receiver.")
+		}
+		ingName, ingNamespace := ingressName()
+		rec := lib.Receiver{Host: *host, Port: *port, Cert: *cert, Paths: pathRules()}
+		merged, err := store.Update(ingName, ingNamespace, rec)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		glog.Infof("Merged receivers of %v: %+v", *ingress, merged)
+	case "remove":
+		if *host == "" || *ingress == "" {
+			glog.Fatalf("Need --host and --ing to remove receiver.")
+		}
+		ingName, ingNamespace := ingressName()
+		remaining, err := store.Remove(ingName, ingNamespace, *host, *port)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		glog.Infof("Remaining receivers of %v: %+v", *ingress, remaining)
+	case "replace":
+		if *ingress == "" {
+			glog.Fatalf("Need --ing to replace receivers.")
+		}
+		ingName, ingNamespace := ingressName()
+		var rec []lib.Receiver
+		if err := json.Unmarshal([]byte(*receivers), &rec); err != nil {
+			glog.Fatalf("--receivers is not a valid json list of receivers: %v", err)
+		}
+		replaced, err := store.ReplaceAll(ingName, ingNamespace, rec)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		glog.Infof("Receivers of %v: %+v", *ingress, replaced)
+	case "list":
+		list, err := store.List(*listNamespace)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		for _, ir := range list {
+			glog.Infof("Receivers of %v/%v: %+v", ir.Namespace, ir.Name, ir.Receivers)
+		}
+	case "watch":
+		events, err := lib.WatchReceivers(store, *listNamespace, make(chan struct{}))
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		for event := range events {
+			glog.Infof("%v receiver of %v/%v: %+v", event.Type, event.IngNamespace, event.IngName, event.Receiver)
+		}
+	case "migrate":
+		// Legacy ConfigMap entries are readable as is and get rewritten
+		// in the new format on their next write.
+		migrated, err := (&lib.AnnotatedReceivers{Client: kubeClient}).Migrate(*listNamespace)
+		for _, ir := range migrated {
+			glog.Infof("Migrated receivers of %v/%v to %v", ir.Namespace, ir.Name, lib.ReceiversVersion)
+		}
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+	case "conflicts":
+		policy := lib.ConflictPolicy{AllowedNamespaces: map[string][]string{}}
+		for _, a := range *allow {
+			hostNamespace := strings.Split(a, ":")
+			if len(hostNamespace) != 2 {
+				glog.Fatalf("--allow should take the form host:namespace, got %v.", a)
+			}
+			policy.AllowedNamespaces[hostNamespace[0]] = append(policy.AllowedNamespaces[hostNamespace[0]], hostNamespace[1])
+		}
+		conflicts, err := store.(conflictFinder).Conflicts(*listNamespace, policy)
+		if err != nil && conflicts == nil {
+			glog.Fatalf("%v", err)
+		}
+		for _, c := range conflicts {
+			owner := "nobody"
+			if c.Owner != nil {
+				owner = c.Owner.String()
+			}
+			glog.Infof("%v:%v is owned by %v, conflicting claims: %v, cert mismatch: %v", c.Host, c.Port, owner, c.Losers, c.CertMismatch)
+		}
+		if err != nil {
+			glog.Errorf("%v", err)
+		}
+		if len(conflicts) != 0 || err != nil {
+			glog.Flush()
+			os.Exit(1)
+		}
+	default:
+		glog.Fatalf("Unknown command %v, expected one of update, remove, replace, list, watch, migrate or conflicts.", cmd)
 	}
-	glog.Infof("Receivers of %v: %+v", *ingress, receivers)
 }
@@ -0,0 +1,102 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+// ReceiverCert is the keypair referenced by the Cert of a Receiver.
+type ReceiverCert struct {
+	tls.Certificate
+	// CertPEM and KeyPEM are the PEM encoded chain and key, as stored in
+	// the secret.
+	CertPEM []byte
+	KeyPEM  []byte
+	// Leaf is the parsed first certificate in the chain.
+	Leaf *x509.Certificate
+	// DNSNames and IPAddresses are the subject alternative names of Leaf.
+	DNSNames    []string
+	IPAddresses []net.IP
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// CoversHost returns true if the certificate is valid for the given host,
+// including wildcard matches.
+func (c *ReceiverCert) CoversHost(host string) bool {
+	return c.Leaf.VerifyHostname(host) == nil
+}
+
+// ExpiresWithin returns true if the certificate is no longer valid d from
+// now.
+func (c *ReceiverCert) ExpiresWithin(d time.Duration) bool {
+	return time.Now().Add(d).After(c.NotAfter)
+}
+
+// ClientSecretGetter returns a SecretGetter backed by the given client.
+func ClientSecretGetter(c *client.Client) SecretGetter {
+	return func(namespace, name string) (*api.Secret, error) {
+		return c.Secrets(namespace).Get(name)
+	}
+}
+
+// ResolveCert loads the secret named by rec.Cert from the given namespace
+// and returns its keypair. The secret can use either the tls.crt/tls.key
+// keys or the <app>.crt/<app>.key keys written by hack/make_secret.go. It
+// fails if the private key doesn't match the certificate.
+func ResolveCert(getSecret SecretGetter, namespace string, rec Receiver) (*ReceiverCert, error) {
+	secret, err := getSecret(namespace, rec.Cert)
+	if err != nil {
+		return nil, err
+	}
+	return certFromSecret(secret)
+}
+
+func certFromSecret(secret *api.Secret) (*ReceiverCert, error) {
+	crt, key, err := certKeyPair(secret)
+	if err != nil {
+		return nil, err
+	}
+	// X509KeyPair checks that the public key of the leaf matches key.
+	keyPair, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return nil, fmt.Errorf("secret %v/%v: %v", secret.Namespace, secret.Name, err)
+	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("secret %v/%v: %v", secret.Namespace, secret.Name, err)
+	}
+	keyPair.Leaf = leaf
+	return &ReceiverCert{
+		Certificate: keyPair,
+		CertPEM:     crt,
+		KeyPEM:      key,
+		Leaf:        leaf,
+		DNSNames:    leaf.DNSNames,
+		IPAddresses: leaf.IPAddresses,
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+	}, nil
+}
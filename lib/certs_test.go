@@ -0,0 +1,85 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// selfSignedCert returns a PEM encoded certificate and key for the given
+// hosts.
+func selfSignedCert(t *testing.T, hosts ...string) ([]byte, []byte) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     hosts,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return crt, key
+}
+
+func TestResolveCert(t *testing.T) {
+	crt, key := selfSignedCert(t, "*.foo.com")
+	_, otherKey := selfSignedCert(t, "bar.com")
+	secrets := map[string]*api.Secret{
+		"tls":      {ObjectMeta: api.ObjectMeta{Name: "tls"}, Data: map[string][]byte{"tls.crt": crt, "tls.key": key}},
+		"app":      {ObjectMeta: api.ObjectMeta{Name: "app"}, Data: map[string][]byte{"nginx.crt": crt, "nginx.key": key}},
+		"mismatch": {ObjectMeta: api.ObjectMeta{Name: "mismatch"}, Data: map[string][]byte{"tls.crt": crt, "tls.key": otherKey}},
+		"empty":    {ObjectMeta: api.ObjectMeta{Name: "empty"}, Data: map[string][]byte{"nginx.crt": crt}},
+	}
+	getSecret := func(namespace, name string) (*api.Secret, error) {
+		return secrets[name], nil
+	}
+	for _, name := range []string{"tls", "app"} {
+		cert, err := ResolveCert(getSecret, "ns", Receiver{Host: "www.foo.com", Port: 443, Cert: name})
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", name, err)
+			continue
+		}
+		if !cert.CoversHost("www.foo.com") || cert.CoversHost("bar.com") {
+			t.Errorf("%v: unexpected SANs %v", name, cert.DNSNames)
+		}
+		if cert.ExpiresWithin(time.Minute) || !cert.ExpiresWithin(2*time.Hour) {
+			t.Errorf("%v: unexpected expiry %v", name, cert.NotAfter)
+		}
+	}
+	for _, name := range []string{"mismatch", "empty"} {
+		if _, err := ResolveCert(getSecret, "ns", Receiver{Host: "www.foo.com", Port: 443, Cert: name}); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// ConfigMap is the wire format of a v1 ConfigMap. The vendored client
+// predates ConfigMaps, so they're read and written through the raw
+// RESTClient.
+type ConfigMap struct {
+	unversioned.TypeMeta `json:",inline"`
+	v1.ObjectMeta        `json:"metadata,omitempty"`
+	Data                 map[string]string `json:"data,omitempty"`
+}
+
+func (*ConfigMap) IsAnAPIObject() {}
+
+// ConfigMapList is the wire format of a v1 ConfigMapList.
+type ConfigMapList struct {
+	unversioned.TypeMeta `json:",inline"`
+	unversioned.ListMeta `json:"metadata,omitempty"`
+	Items                []ConfigMap `json:"items"`
+}
+
+// GetConfigMap fetches the ConfigMap with the given namespace and name.
+func GetConfigMap(c *client.Client, namespace, name string) (*ConfigMap, error) {
+	body, err := c.Get().Namespace(namespace).Resource("configmaps").Name(name).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	cm := &ConfigMap{}
+	if err := json.Unmarshal(body, cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// ListConfigMaps lists the ConfigMaps with the given name in a namespace, or
+// in every namespace for api.NamespaceAll.
+func ListConfigMaps(c *client.Client, namespace, name string) (*ConfigMapList, error) {
+	body, err := c.Get().
+		Namespace(namespace).
+		Resource("configmaps").
+		FieldsSelectorParam(fields.OneTermEqualSelector("metadata.name", name)).
+		Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	cms := &ConfigMapList{}
+	if err := json.Unmarshal(body, cms); err != nil {
+		return nil, err
+	}
+	return cms, nil
+}
+
+// WatchConfigMaps watches the ConfigMaps with the given name, from the
+// resourceVersion of a ListConfigMaps. Event objects are *ConfigMap.
+func WatchConfigMaps(c *client.Client, namespace, name, resourceVersion string) (watch.Interface, error) {
+	stream, err := c.Get().
+		Prefix("watch").
+		Namespace(namespace).
+		Resource("configmaps").
+		Param("resourceVersion", resourceVersion).
+		FieldsSelectorParam(fields.OneTermEqualSelector("metadata.name", name)).
+		Stream()
+	if err != nil {
+		return nil, err
+	}
+	return watch.NewStreamWatcher(&configMapDecoder{stream: stream, decoder: json.NewDecoder(stream)}), nil
+}
+
+// configMapDecoder decodes a json stream of ConfigMap watch events.
+type configMapDecoder struct {
+	stream  io.ReadCloser
+	decoder *json.Decoder
+}
+
+func (d *configMapDecoder) Decode() (watch.EventType, runtime.Object, error) {
+	var event struct {
+		Type   watch.EventType `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := d.decoder.Decode(&event); err != nil {
+		return "", nil, err
+	}
+	if event.Type == watch.Error {
+		status := &unversioned.Status{}
+		if err := json.Unmarshal(event.Object, status); err != nil {
+			return "", nil, err
+		}
+		return "", nil, errors.FromObject(status)
+	}
+	cm := &ConfigMap{}
+	if err := json.Unmarshal(event.Object, cm); err != nil {
+		return "", nil, err
+	}
+	return event.Type, cm, nil
+}
+
+func (d *configMapDecoder) Close() {
+	d.stream.Close()
+}
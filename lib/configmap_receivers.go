@@ -0,0 +1,260 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// DefaultReceiversConfigMap is the name of the ConfigMap used by
+// ConfigMapReceivers when none is given.
+const DefaultReceiversConfigMap = "ingress-receivers"
+
+// ConfigMapReceivers is a ReceiverStore that keeps the receivers of every
+// Ingress in a namespace in a single ConfigMap, keyed by Ingress name.
+// Unlike AnnotatedReceivers it isn't bound by the size limit on the
+// annotations of an Ingress.
+type ConfigMapReceivers struct {
+	Client *client.Client
+	// Name of the ConfigMap in each namespace, DefaultReceiversConfigMap
+	// if empty.
+	Name string
+}
+
+var _ ReceiverStore = &ConfigMapReceivers{}
+
+func (r *ConfigMapReceivers) name() string {
+	if r.Name == "" {
+		return DefaultReceiversConfigMap
+	}
+	return r.Name
+}
+
+// getConfigMap returns the receivers ConfigMap of the namespace.
+func (r *ConfigMapReceivers) getConfigMap(namespace string) (*ConfigMap, error) {
+	return GetConfigMap(r.Client, namespace, r.name())
+}
+
+// decodeConfigMap returns the receivers of every Ingress in the ConfigMap.
+func decodeConfigMap(cm *ConfigMap) ([]IngressReceivers, error) {
+	list := []IngressReceivers{}
+	for ingName, jsonRec := range cm.Data {
+		rec, _, err := decodeReceiverList(jsonRec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode receivers of %v/%v from configmap %v: %v", cm.Namespace, ingName, cm.Name, err)
+		}
+		list = append(list, IngressReceivers{Name: ingName, Namespace: cm.Namespace, Receivers: rec})
+	}
+	return list, nil
+}
+
+func (r *ConfigMapReceivers) Get(ingName, ingNamespace string) ([]Receiver, error) {
+	cm, err := r.getConfigMap(ingNamespace)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	jsonRec, ok := cm.Data[ingName]
+	if !ok {
+		return nil, nil
+	}
+	rec, _, err := decodeReceiverList(jsonRec)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(ingName, ingNamespace, rec, ClientSecretGetter(r.Client)); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns the receivers of every Ingress in the receivers ConfigMap of
+// the given namespace, or of every namespace for api.NamespaceAll.
+func (r *ConfigMapReceivers) List(ingNamespace string) ([]IngressReceivers, error) {
+	cms, err := ListConfigMaps(r.Client, ingNamespace, r.name())
+	if err != nil {
+		return nil, err
+	}
+	list := []IngressReceivers{}
+	for i := range cms.Items {
+		rec, err := decodeConfigMap(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, rec...)
+	}
+	return list, nil
+}
+
+// Watch follows the receivers ConfigMaps and sends the receivers of every
+// Ingress whose key changed.
+func (r *ConfigMapReceivers) Watch(ingNamespace string, stopCh <-chan struct{}) (<-chan IngressReceivers, error) {
+	source := &snapshotSource{
+		list: func() ([]scopedSnapshot, string, error) {
+			cms, err := ListConfigMaps(r.Client, ingNamespace, r.name())
+			if err != nil {
+				return nil, "", err
+			}
+			snapshots := []scopedSnapshot{}
+			for i := range cms.Items {
+				rec, err := decodeConfigMap(&cms.Items[i])
+				snapshots = append(snapshots, scopedSnapshot{scope: cms.Items[i].Namespace, receivers: rec, err: err})
+			}
+			return snapshots, cms.ResourceVersion, nil
+		},
+		watch: func(resourceVersion string) (watch.Interface, error) {
+			return WatchConfigMaps(r.Client, ingNamespace, r.name(), resourceVersion)
+		},
+		decode: func(event watch.Event) (scopedSnapshot, error) {
+			cm, ok := event.Object.(*ConfigMap)
+			if !ok {
+				return scopedSnapshot{}, fmt.Errorf("unexpected object in configmap watch: %+v", event.Object)
+			}
+			snapshot := scopedSnapshot{scope: cm.Namespace}
+			if event.Type == watch.Deleted {
+				return snapshot, nil
+			}
+			rec, err := decodeConfigMap(cm)
+			snapshot.receivers = rec
+			return snapshot, err
+		},
+	}
+	return source.run(stopCh)
+}
+
+// Conflicts returns the receiver conflicts between every Ingress in the
+// given namespace, or across the cluster for api.NamespaceAll, like
+// FindConflicts. Receivers of Ingresses that don't exist claim nothing.
+func (r *ConfigMapReceivers) Conflicts(ingNamespace string, policy ConflictPolicy) ([]Conflict, error) {
+	ings, err := r.Client.Experimental().Ingress(ingNamespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	cms, err := ListConfigMaps(r.Client, ingNamespace, r.name())
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*extensions.Ingress{}
+	for i := range ings.Items {
+		byName[ings.Items[i].Namespace+"/"+ings.Items[i].Name] = &ings.Items[i]
+	}
+	claims := []Claim{}
+	errs := []error{}
+	for _, cm := range cms.Items {
+		for ingName, jsonRec := range cm.Data {
+			ing, ok := byName[cm.Namespace+"/"+ingName]
+			if !ok {
+				continue
+			}
+			rec, _, err := decodeReceiverList(jsonRec)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to decode receivers of %v/%v from configmap %v: %v", cm.Namespace, ingName, cm.Name, err))
+				continue
+			}
+			claims = append(claims, claimsOf(ing, rec)...)
+		}
+	}
+	return findConflicts(claims, policy), skippedError(errs)
+}
+
+func (r *ConfigMapReceivers) Update(ingName, ingNamespace string, rec Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, mergeReceiver(rec))
+}
+
+func (r *ConfigMapReceivers) Remove(ingName, ingNamespace, host string, port int) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, removeReceiver(host, port))
+}
+
+func (r *ConfigMapReceivers) ReplaceAll(ingName, ingNamespace string, rec []Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, replaceReceivers(rec))
+}
+
+// modify applies mutate to the receivers of the given Ingress, creating the
+// ConfigMap if it doesn't exist and retrying on conflicts.
+func (r *ConfigMapReceivers) modify(ingName, ingNamespace string, mutate receiverMutator) (receivers []Receiver, err error) {
+	err = retryOnConflict(fmt.Sprintf("receivers of %v/%v in configmap %v", ingNamespace, ingName, r.name()), func() error {
+		receivers, err = r.tryModify(ingName, ingNamespace, mutate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receivers, nil
+}
+
+func (r *ConfigMapReceivers) tryModify(ingName, ingNamespace string, mutate receiverMutator) ([]Receiver, error) {
+	create := false
+	cm, err := r.getConfigMap(ingNamespace)
+	if errors.IsNotFound(err) {
+		create = true
+		cm = &ConfigMap{
+			TypeMeta:   unversioned.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: v1.ObjectMeta{Name: r.name(), Namespace: ingNamespace},
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	var old []Receiver
+	if jsonRec, ok := cm.Data[ingName]; ok {
+		if old, _, err = decodeReceiverList(jsonRec); err != nil {
+			return nil, err
+		}
+	}
+	receivers, err := mutate(copyReceivers(old))
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChange(ingName, ingNamespace, old, receivers, ClientSecretGetter(r.Client)); err != nil {
+		return nil, err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if len(receivers) == 0 {
+		delete(cm.Data, ingName)
+	} else {
+		jsonReceivers, err := encodeReceiverList(receivers)
+		if err != nil {
+			return nil, err
+		}
+		cm.Data[ingName] = jsonReceivers
+	}
+	body, err := json.Marshal(cm)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		err = r.Client.Post().Namespace(ingNamespace).Resource("configmaps").Body(body).Do().Error()
+	} else {
+		err = r.Client.Put().Namespace(ingNamespace).Resource("configmaps").Name(r.name()).Body(body).Do().Error()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return receivers, nil
+}
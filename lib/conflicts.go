@@ -0,0 +1,214 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	utilerrors "k8s.io/kubernetes/pkg/util/errors"
+)
+
+// Claim is a receiver annotated on an Ingress, which claims its host and
+// port for that Ingress.
+type Claim struct {
+	IngName      string
+	IngNamespace string
+	// Created is the creation time of the Ingress.
+	Created  unversioned.Time
+	Receiver Receiver
+}
+
+func (c Claim) String() string {
+	return fmt.Sprintf("%v/%v (cert %v)", c.IngNamespace, c.IngName, c.Receiver.Cert)
+}
+
+// Conflict is a host and port claimed by more than one Ingress, or only by
+// Ingresses the ConflictPolicy doesn't allow to own it.
+type Conflict struct {
+	Host string
+	Port int
+	// Owner is the claim that wins under the ConflictPolicy. It's nil if no
+	// claim is allowed to own the host.
+	Owner *Claim
+	// Losers are the other claims, oldest first.
+	Losers []Claim
+	// CertMismatch is true if the claims reference different certs.
+	CertMismatch bool
+}
+
+// ConflictPolicy decides which claim owns a contested host and port. By
+// default the oldest Ingress wins.
+type ConflictPolicy struct {
+	// AllowedNamespaces maps a host to the only namespaces allowed to claim
+	// it. The oldest claim from an allowed namespace wins, claims from
+	// other namespaces always lose. Hosts not in the map fall back to
+	// oldest wins.
+	AllowedNamespaces map[string][]string
+}
+
+// allowed returns true if the policy lets the claim own its host.
+func (p ConflictPolicy) allowed(c Claim) bool {
+	namespaces, ok := p.AllowedNamespaces[c.Receiver.Host]
+	if !ok {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == c.IngNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// FindConflicts returns every host and port claimed through the receivers
+// annotation of more than one of the given Ingresses, or only by Ingresses
+// the policy doesn't allow to own it, sorted by host and port. Hosts are
+// compared literally, so a wildcard doesn't conflict with the hosts it
+// matches. Ingresses with an undecodable annotation are left out, and
+// returned as an error along with the conflicts between the others.
+func FindConflicts(ings []extensions.Ingress, policy ConflictPolicy) ([]Conflict, error) {
+	claims := []Claim{}
+	errs := []error{}
+	for i := range ings {
+		ing := &ings[i]
+		rec, err := decodeReceivers(ing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode receivers of %v/%v: %v", ing.Namespace, ing.Name, err))
+			continue
+		}
+		claims = append(claims, claimsOf(ing, rec)...)
+	}
+	return findConflicts(claims, policy), skippedError(errs)
+}
+
+// claimsOf returns the claims of the given receivers of an Ingress.
+func claimsOf(ing *extensions.Ingress, rec []Receiver) []Claim {
+	claims := []Claim{}
+	for _, r := range rec {
+		claims = append(claims, Claim{
+			IngName:      ing.Name,
+			IngNamespace: ing.Namespace,
+			Created:      ing.CreationTimestamp,
+			Receiver:     r,
+		})
+	}
+	return claims
+}
+
+// skippedError returns an error listing the Ingresses left out of a
+// conflict report, nil if there are none.
+func skippedError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("skipped undecodable receivers: %v", utilerrors.NewAggregate(errs))
+}
+
+// findConflicts groups claims by host and port and returns the contested
+// ones, sorted by host and port.
+func findConflicts(all []Claim, policy ConflictPolicy) []Conflict {
+	claims := map[string][]Claim{}
+	for _, c := range all {
+		key := fmt.Sprintf("%v:%v", c.Receiver.Host, c.Receiver.Port)
+		claims[key] = append(claims[key], c)
+	}
+	conflicts := []Conflict{}
+	for _, c := range claims {
+		if len(c) == 1 && policy.allowed(c[0]) {
+			continue
+		}
+		sort.Sort(byAge(c))
+		conflict := Conflict{Host: c[0].Receiver.Host, Port: c[0].Receiver.Port}
+		for i := range c {
+			if c[i].Receiver.Cert != c[0].Receiver.Cert {
+				conflict.CertMismatch = true
+			}
+			if conflict.Owner == nil && policy.allowed(c[i]) {
+				owner := c[i]
+				conflict.Owner = &owner
+			} else {
+				conflict.Losers = append(conflict.Losers, c[i])
+			}
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Sort(byHostPort(conflicts))
+	return conflicts
+}
+
+// Conflicts returns the receiver conflicts between every Ingress in the
+// given namespace, or across the cluster for api.NamespaceAll.
+func (r *AnnotatedReceivers) Conflicts(ingNamespace string, policy ConflictPolicy) ([]Conflict, error) {
+	ings, err := r.Client.Experimental().Ingress(ingNamespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return FindConflicts(ings.Items, policy)
+}
+
+// olderThan returns true if the Ingress created at a with the given
+// namespace and name wins a contested host over the one created at b: the
+// oldest wins, and ties are broken by namespace and name so the owner is
+// stable.
+func olderThan(a unversioned.Time, aNamespace, aName string, b unversioned.Time, bNamespace, bName string) bool {
+	if !a.Equal(b) {
+		return a.Before(b)
+	}
+	if aNamespace != bNamespace {
+		return aNamespace < bNamespace
+	}
+	return aName < bName
+}
+
+// SortByAge sorts Ingresses oldest first, the order in which they own
+// contested hosts without a ConflictPolicy.
+func SortByAge(ings []extensions.Ingress) {
+	sort.Sort(ingressesByAge(ings))
+}
+
+type ingressesByAge []extensions.Ingress
+
+func (i ingressesByAge) Len() int      { return len(i) }
+func (i ingressesByAge) Swap(a, b int) { i[a], i[b] = i[b], i[a] }
+func (i ingressesByAge) Less(a, b int) bool {
+	return olderThan(i[a].CreationTimestamp, i[a].Namespace, i[a].Name, i[b].CreationTimestamp, i[b].Namespace, i[b].Name)
+}
+
+// byAge sorts claims oldest first.
+type byAge []Claim
+
+func (c byAge) Len() int      { return len(c) }
+func (c byAge) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byAge) Less(i, j int) bool {
+	return olderThan(c[i].Created, c[i].IngNamespace, c[i].IngName, c[j].Created, c[j].IngNamespace, c[j].IngName)
+}
+
+type byHostPort []Conflict
+
+func (c byHostPort) Len() int      { return len(c) }
+func (c byHostPort) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byHostPort) Less(i, j int) bool {
+	if c[i].Host != c[j].Host {
+		return c[i].Host < c[j].Host
+	}
+	return c[i].Port < c[j].Port
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+func newIngress(name, namespace string, age time.Duration, receivers string) extensions.Ingress {
+	return extensions.Ingress{
+		ObjectMeta: api.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: unversioned.NewTime(time.Unix(0, 0).Add(-age)),
+			Annotations:       map[string]string{receiversKey: receivers},
+		},
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	ings := []extensions.Ingress{
+		newIngress("new", "a", time.Minute, `[{"host":"foo.com","port":443,"cert":"foo"}]`),
+		newIngress("old", "b", time.Hour, `[{"host":"foo.com","port":443,"cert":"foo"},{"host":"bar.com","port":443,"cert":"bar"}]`),
+		newIngress("other", "c", time.Minute, `[{"host":"bar.com","port":80,"cert":"bar"},{"host":"foo.com","port":443,"cert":"other"}]`),
+	}
+	conflicts, err := FindConflicts(ings, ConflictPolicy{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %+v", conflicts)
+	}
+	c := conflicts[0]
+	if c.Host != "foo.com" || c.Port != 443 || !c.CertMismatch {
+		t.Errorf("unexpected conflict %+v", c)
+	}
+	if c.Owner == nil || c.Owner.IngName != "old" {
+		t.Errorf("expected the oldest ingress to own foo.com, got %+v", c.Owner)
+	}
+	if len(c.Losers) != 2 || c.Losers[0].IngName != "new" || c.Losers[1].IngName != "other" {
+		t.Errorf("unexpected losers %+v", c.Losers)
+	}
+
+	conflicts, _ = FindConflicts(ings, ConflictPolicy{AllowedNamespaces: map[string][]string{"foo.com": {"c"}}})
+	if owner := conflicts[0].Owner; owner == nil || owner.IngName != "other" {
+		t.Errorf("expected the allowed namespace to own foo.com, got %+v", owner)
+	}
+	conflicts, _ = FindConflicts(ings, ConflictPolicy{AllowedNamespaces: map[string][]string{"foo.com": {"d"}}})
+	if owner := conflicts[0].Owner; owner != nil {
+		t.Errorf("expected no owner for foo.com, got %+v", owner)
+	}
+
+	conflicts, _ = FindConflicts(ings, ConflictPolicy{AllowedNamespaces: map[string][]string{"bar.com": {"b"}}})
+	if len(conflicts) != 2 || conflicts[0].Host != "bar.com" || conflicts[0].Port != 80 || conflicts[0].Owner != nil {
+		t.Errorf("expected bar.com:80, claimed only by a disallowed namespace, to be reported, got %+v", conflicts)
+	}
+
+	ings = append(ings, newIngress("broken", "d", time.Minute, `{"version":"v2"}`))
+	conflicts, err = FindConflicts(ings, ConflictPolicy{})
+	if err == nil || !strings.Contains(err.Error(), "d/broken") {
+		t.Errorf("expected the undecodable annotation of d/broken to be reported, got %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Host != "foo.com" {
+		t.Errorf("expected the conflicts of the other Ingresses, got %+v", conflicts)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// MemoryReceivers is a ReceiverStore that keeps receivers in memory. It's
+// meant for tests that need a store without an apiserver.
+type MemoryReceivers struct {
+	// GetSecret, if set, is used to validate the cert of each receiver.
+	// Otherwise only the fields of receivers are validated.
+	GetSecret SecretGetter
+
+	lock      sync.Mutex
+	receivers map[string]IngressReceivers
+	watchers  []*memoryWatcher
+}
+
+var _ ReceiverStore = &MemoryReceivers{}
+
+// NewMemoryReceivers returns a MemoryReceivers seeded with the given
+// receivers.
+func NewMemoryReceivers(initial ...IngressReceivers) *MemoryReceivers {
+	r := &MemoryReceivers{receivers: map[string]IngressReceivers{}}
+	for _, ir := range initial {
+		r.receivers[ir.Namespace+"/"+ir.Name] = ir
+	}
+	return r
+}
+
+func (r *MemoryReceivers) Get(ingName, ingNamespace string) ([]Receiver, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rec := copyReceivers(r.receivers[ingNamespace+"/"+ingName].Receivers)
+	if err := validate(ingName, ingNamespace, rec, r.GetSecret); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns receivers sorted by namespace/name.
+func (r *MemoryReceivers) List(ingNamespace string) ([]IngressReceivers, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.listLocked(ingNamespace), nil
+}
+
+func (r *MemoryReceivers) listLocked(ingNamespace string) []IngressReceivers {
+	keys := []string{}
+	for key, ir := range r.receivers {
+		if ingNamespace == api.NamespaceAll || ir.Namespace == ingNamespace {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	list := []IngressReceivers{}
+	for _, key := range keys {
+		ir := r.receivers[key]
+		ir.Receivers = copyReceivers(ir.Receivers)
+		list = append(list, ir)
+	}
+	return list
+}
+
+func (r *MemoryReceivers) Update(ingName, ingNamespace string, rec Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, mergeReceiver(rec))
+}
+
+func (r *MemoryReceivers) Remove(ingName, ingNamespace, host string, port int) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, removeReceiver(host, port))
+}
+
+func (r *MemoryReceivers) ReplaceAll(ingName, ingNamespace string, rec []Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, replaceReceivers(copyReceivers(rec)))
+}
+
+func (r *MemoryReceivers) modify(ingName, ingNamespace string, mutate receiverMutator) ([]Receiver, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := ingNamespace + "/" + ingName
+	old := r.receivers[key].Receivers
+	receivers, err := mutate(copyReceivers(old))
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChange(ingName, ingNamespace, old, receivers, r.GetSecret); err != nil {
+		return nil, err
+	}
+	ir := IngressReceivers{Name: ingName, Namespace: ingNamespace, Receivers: receivers}
+	if len(receivers) == 0 {
+		delete(r.receivers, key)
+		ir.Receivers = nil
+	} else {
+		r.receivers[key] = ir
+	}
+	for _, w := range r.watchers {
+		if w.namespace == api.NamespaceAll || w.namespace == ingNamespace {
+			w.send(IngressReceivers{Name: ingName, Namespace: ingNamespace, Receivers: copyReceivers(ir.Receivers)})
+		}
+	}
+	return copyReceivers(receivers), nil
+}
+
+// Watch sends the current receivers of the namespace followed by every
+// change made through this store.
+func (r *MemoryReceivers) Watch(ingNamespace string, stopCh <-chan struct{}) (<-chan IngressReceivers, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	w := &memoryWatcher{
+		namespace: ingNamespace,
+		pending:   r.listLocked(ingNamespace),
+		notify:    make(chan struct{}, 1),
+		out:       make(chan IngressReceivers),
+	}
+	r.watchers = append(r.watchers, w)
+	go func() {
+		w.run(stopCh)
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		for i := range r.watchers {
+			if r.watchers[i] == w {
+				r.watchers = append(r.watchers[:i], r.watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return w.out, nil
+}
+
+// memoryWatcher queues changes so writers to MemoryReceivers never block
+// on a slow watcher.
+type memoryWatcher struct {
+	namespace string
+	lock      sync.Mutex
+	pending   []IngressReceivers
+	notify    chan struct{}
+	out       chan IngressReceivers
+}
+
+func (w *memoryWatcher) send(ir IngressReceivers) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.pending = append(w.pending, ir)
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) run(stopCh <-chan struct{}) {
+	defer close(w.out)
+	for {
+		w.lock.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.lock.Unlock()
+		for _, ir := range pending {
+			select {
+			case <-stopCh:
+				return
+			case w.out <- ir:
+			}
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-w.notify:
+		}
+	}
+}
+
+func copyReceivers(rec []Receiver) []Receiver {
+	if rec == nil {
+		return nil
+	}
+	return append([]Receiver{}, rec...)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+)
+
+func TestMemoryReceivers(t *testing.T) {
+	foo := Receiver{Host: "foo.com", Port: 443, Cert: "foosecret"}
+	bar := Receiver{Host: "bar.com", Port: 443, Cert: "barsecret"}
+	store := NewMemoryReceivers(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo}})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	events, err := store.Watch("ns", stopCh)
+	if err != nil {
+		t.Fatalf("unexpected error watching: %v", err)
+	}
+	expectEvent := func(expected IngressReceivers) {
+		if ir := <-events; !reflect.DeepEqual(ir, expected) {
+			t.Errorf("expected %+v, got %+v", expected, ir)
+		}
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo}})
+
+	if merged, err := store.Update("ing", "ns", bar); err != nil || !reflect.DeepEqual(merged, []Receiver{foo, bar}) {
+		t.Errorf("unexpected result from Update: %+v, %v", merged, err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo, bar}})
+
+	foo.Cert = "othersecret"
+	if merged, err := store.Update("ing", "ns", foo); err != nil || !reflect.DeepEqual(merged, []Receiver{foo, bar}) {
+		t.Errorf("expected Update to replace the receiver with the same host and port, got %+v, %v", merged, err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo, bar}})
+
+	foo8443 := Receiver{Host: "foo.com", Port: 8443, Cert: "foosecret"}
+	if merged, err := store.Update("ing", "ns", foo8443); err != nil || !reflect.DeepEqual(merged, []Receiver{foo, bar, foo8443}) {
+		t.Errorf("expected Update to add the host on another port, got %+v, %v", merged, err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo, bar, foo8443}})
+
+	if _, err := store.Update("ing", "ns", Receiver{Host: "baz.com"}); err == nil {
+		t.Errorf("expected Update to reject an invalid receiver")
+	}
+	if _, err := store.Remove("ing", "ns", "baz.com", 0); err == nil {
+		t.Errorf("expected Remove of an unknown host to fail")
+	}
+	if _, err := store.Remove("ing", "ns", "foo.com", 80); err == nil {
+		t.Errorf("expected Remove of an unknown port to fail")
+	}
+	if remaining, err := store.Remove("ing", "ns", "foo.com", 8443); err != nil || !reflect.DeepEqual(remaining, []Receiver{foo, bar}) {
+		t.Errorf("expected Remove to only drop foo.com:8443, got %+v, %v", remaining, err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo, bar}})
+	if _, err := store.Update("ing", "ns", foo8443); err != nil {
+		t.Errorf("unexpected error from Update: %v", err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo, bar, foo8443}})
+	if remaining, err := store.Remove("ing", "ns", "foo.com", 0); err != nil || !reflect.DeepEqual(remaining, []Receiver{bar}) {
+		t.Errorf("expected Remove to drop every port of foo.com, got %+v, %v", remaining, err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{bar}})
+
+	if _, err := store.ReplaceAll("ing", "ns", nil); err != nil {
+		t.Errorf("unexpected error from ReplaceAll: %v", err)
+	}
+	expectEvent(IngressReceivers{Name: "ing", Namespace: "ns"})
+	if list, _ := store.List("ns"); len(list) != 0 {
+		t.Errorf("expected no receivers, got %+v", list)
+	}
+}
+
+func TestMemoryReceiversStaleSecret(t *testing.T) {
+	crt, key := selfSignedCert(t, "foo.com")
+	stale := Receiver{Host: "stale.com", Port: 443, Cert: "deleted"}
+	foo := Receiver{Host: "foo.com", Port: 443, Cert: "foosecret"}
+	store := NewMemoryReceivers(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{stale, foo}})
+	store.GetSecret = func(namespace, name string) (*api.Secret, error) {
+		if name != "foosecret" {
+			return nil, errors.NewNotFound("secrets", name)
+		}
+		return &api.Secret{ObjectMeta: api.ObjectMeta{Name: name, Namespace: namespace}, Data: map[string][]byte{"tls.crt": crt, "tls.key": key}}, nil
+	}
+
+	bar := Receiver{Host: "bar.com", Port: 443, Cert: "foosecret"}
+	if merged, err := store.Update("ing", "ns", bar); err != nil || !reflect.DeepEqual(merged, []Receiver{stale, foo, bar}) {
+		t.Errorf("expected a receiver with a deleted secret not to block Update, got %+v, %v", merged, err)
+	}
+	if remaining, err := store.Remove("ing", "ns", "foo.com", 443); err != nil || !reflect.DeepEqual(remaining, []Receiver{stale, bar}) {
+		t.Errorf("expected a receiver with a deleted secret not to block Remove, got %+v, %v", remaining, err)
+	}
+	if _, err := store.Update("ing", "ns", Receiver{Host: "baz.com", Port: 443, Cert: "missing"}); err == nil {
+		t.Errorf("expected Update to reject a receiver with a missing secret")
+	}
+	if remaining, err := store.Remove("ing", "ns", "stale.com", 0); err != nil || !reflect.DeepEqual(remaining, []Receiver{bar}) {
+		t.Errorf("expected the receiver with a deleted secret to be removable, got %+v, %v", remaining, err)
+	}
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package lib
 
 import (
-	"encoding/json"
+	"fmt"
 
 	"k8s.io/kubernetes/pkg/apis/extensions"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/util"
+	utilerrors "k8s.io/kubernetes/pkg/util/errors"
+	"k8s.io/kubernetes/pkg/watch"
 )
 
 const receiversKey = "Ingress.receivers"
@@ -29,6 +34,38 @@ type Receiver struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
 	Cert string `json:"cert"`
+	// Paths route requests for Host to backends. They're optional, a
+	// receiver without paths uses the rules of its Ingress.
+	Paths []PathRule `json:"paths,omitempty"`
+}
+
+// PathMatchType is how a PathRule compares its path to a request.
+type PathMatchType string
+
+const (
+	// PathMatchPrefix matches any request path starting with the path.
+	PathMatchPrefix PathMatchType = "Prefix"
+	// PathMatchExact only matches the path itself.
+	PathMatchExact PathMatchType = "Exact"
+	// PathMatchRegex treats the path as a regular expression.
+	PathMatchRegex PathMatchType = "Regex"
+)
+
+// PathRule sends requests matching Path to a service.
+type PathRule struct {
+	Path string `json:"path"`
+	// Match defaults to PathMatchPrefix.
+	Match       PathMatchType    `json:"match,omitempty"`
+	ServiceName string           `json:"serviceName"`
+	ServicePort util.IntOrString `json:"servicePort"`
+}
+
+// MatchType returns the match type of the rule, applying the default.
+func (p PathRule) MatchType() PathMatchType {
+	if p.Match == "" {
+		return PathMatchPrefix
+	}
+	return p.Match
 }
 
 type ingAnnotations map[string]string
@@ -38,56 +75,249 @@ func (i ingAnnotations) getReceivers() (string, bool) {
 	return s, ok
 }
 
+// IngressReceivers is the list of receivers of a single Ingress.
+type IngressReceivers struct {
+	Name      string
+	Namespace string
+	Receivers []Receiver
+}
+
+// decodeReceivers returns the receivers annotated on the given Ingress.
+func decodeReceivers(ing *extensions.Ingress) (rec []Receiver, err error) {
+	if jsonRec, ok := ingAnnotations(ing.Annotations).getReceivers(); ok {
+		rec, _, err = decodeReceiverList(jsonRec)
+	}
+	return
+}
+
+// AnnotatedReceivers is a ReceiverStore that keeps the receivers of an
+// Ingress as json in its annotations.
 type AnnotatedReceivers struct {
 	Client *client.Client
 }
 
-func (r *AnnotatedReceivers) Get(ingName, ingNamespace string) (rec []Receiver, err error) {
+var _ ReceiverStore = &AnnotatedReceivers{}
+
+func (r *AnnotatedReceivers) Get(ingName, ingNamespace string) ([]Receiver, error) {
 	// Get the Ingress, lookup it's receivers from annotations and return a decoded list.
-	var ing *extensions.Ingress
-	ing, err = r.Client.Experimental().Ingress(ingNamespace).Get(ingName)
+	ing, err := r.Client.Experimental().Ingress(ingNamespace).Get(ingName)
 	if err != nil {
-		return
+		return nil, err
 	}
-	if jsonRec, ok := ingAnnotations(ing.Annotations).getReceivers(); ok {
-		err = json.Unmarshal([]byte(jsonRec), &rec)
+	rec, err := decodeReceivers(ing)
+	if err != nil {
+		return nil, err
 	}
-	return
+	if err := validate(ingName, ingNamespace, rec, ClientSecretGetter(r.Client)); err != nil {
+		return nil, err
+	}
+	return rec, nil
 }
 
-func (r *AnnotatedReceivers) Update(ingName, ingNamespace string, rec Receiver) error {
-	// Get the Ingress, decode it's receivers, add new receiver, encode receiver list,
-	// update annotations. We could call GetReceivers but there's a condition where we might
-	// clobber during the update if we don't reuse this Ingress.
-	var ing *extensions.Ingress
-	var err error
-	ing, err = r.Client.Experimental().Ingress(ingNamespace).Get(ingName)
+// List returns the receivers of every Ingress in the given namespace. Use
+// api.NamespaceAll to list receivers across the cluster. Ingresses without
+// a receivers annotation are skipped.
+func (r *AnnotatedReceivers) List(ingNamespace string) ([]IngressReceivers, error) {
+	ings, err := r.Client.Experimental().Ingress(ingNamespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	list := []IngressReceivers{}
+	for i := range ings.Items {
+		ing := &ings.Items[i]
+		if _, ok := ingAnnotations(ing.Annotations).getReceivers(); !ok {
+			continue
+		}
+		rec, err := decodeReceivers(ing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode receivers of %v/%v: %v", ing.Namespace, ing.Name, err)
+		}
+		list = append(list, IngressReceivers{Name: ing.Name, Namespace: ing.Namespace, Receivers: rec})
+	}
+	return list, nil
+}
+
+// Watch follows the Ingresses in the given namespace and sends their
+// receivers every time the annotation changes.
+func (r *AnnotatedReceivers) Watch(ingNamespace string, stopCh <-chan struct{}) (<-chan IngressReceivers, error) {
+	source := &snapshotSource{
+		list: func() ([]scopedSnapshot, string, error) {
+			ings, err := r.Client.Experimental().Ingress(ingNamespace).List(labels.Everything(), fields.Everything())
+			if err != nil {
+				return nil, "", err
+			}
+			snapshots := []scopedSnapshot{}
+			for i := range ings.Items {
+				snapshot, err := ingressSnapshot(&ings.Items[i], false)
+				snapshot.err = err
+				snapshots = append(snapshots, snapshot)
+			}
+			return snapshots, ings.ResourceVersion, nil
+		},
+		watch: func(resourceVersion string) (watch.Interface, error) {
+			return r.Client.Experimental().Ingress(ingNamespace).Watch(labels.Everything(), fields.Everything(), resourceVersion)
+		},
+		decode: func(event watch.Event) (scopedSnapshot, error) {
+			ing, ok := event.Object.(*extensions.Ingress)
+			if !ok {
+				return scopedSnapshot{}, fmt.Errorf("unexpected object in ingress watch: %+v", event.Object)
+			}
+			return ingressSnapshot(ing, event.Type == watch.Deleted)
+		},
+	}
+	return source.run(stopCh)
+}
+
+// ingressSnapshot returns the receivers of a single Ingress, scoped to that
+// Ingress. A deleted Ingress has no receivers.
+func ingressSnapshot(ing *extensions.Ingress, deleted bool) (scopedSnapshot, error) {
+	snapshot := scopedSnapshot{scope: ing.Namespace + "/" + ing.Name}
+	if deleted {
+		return snapshot, nil
+	}
+	rec, err := decodeReceivers(ing)
 	if err != nil {
+		return snapshot, fmt.Errorf("failed to decode receivers of %v: %v", snapshot.scope, err)
+	}
+	if len(rec) != 0 {
+		snapshot.receivers = []IngressReceivers{{Name: ing.Name, Namespace: ing.Namespace, Receivers: rec}}
+	}
+	return snapshot, nil
+}
+
+// Update merges rec into the receivers of the given Ingress, replacing any
+// existing receiver with the same Host and Port. It returns the receiver
+// list that was written.
+func (r *AnnotatedReceivers) Update(ingName, ingNamespace string, rec Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, mergeReceiver(rec))
+}
+
+// Remove deletes the receiver with the given host and port, or every
+// receiver of the host for port 0, from the Ingress. It returns the
+// remaining receivers, or an error if no receiver matched.
+func (r *AnnotatedReceivers) Remove(ingName, ingNamespace, host string, port int) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, removeReceiver(host, port))
+}
+
+// ReplaceAll overwrites the receivers of the given Ingress with rec in a
+// single write.
+func (r *AnnotatedReceivers) ReplaceAll(ingName, ingNamespace string, rec []Receiver) ([]Receiver, error) {
+	return r.modify(ingName, ingNamespace, replaceReceivers(rec))
+}
+
+// modify applies mutate to the receivers of the given Ingress and writes the
+// result back. If the write races with another writer and fails with a
+// conflict, the Ingress is re-read, mutate is re-applied and the write is
+// retried.
+func (r *AnnotatedReceivers) modify(ingName, ingNamespace string, mutate receiverMutator) (receivers []Receiver, err error) {
+	err = retryOnConflict(fmt.Sprintf("receivers of %v/%v", ingNamespace, ingName), func() error {
+		receivers, err = r.tryModify(ingName, ingNamespace, mutate)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	var receivers []Receiver
-	if jsonRec, ok := ingAnnotations(ing.Annotations).getReceivers(); ok {
-		if err := json.Unmarshal([]byte(jsonRec), &receivers); err != nil {
+	return receivers, nil
+}
+
+// tryModify makes a single attempt at mutating the receivers of the Ingress.
+func (r *AnnotatedReceivers) tryModify(ingName, ingNamespace string, mutate receiverMutator) ([]Receiver, error) {
+	// Get the Ingress, decode it's receivers, mutate them, encode receiver list,
+	// update annotations. We could call Get but there's a condition where we might
+	// clobber during the update if we don't reuse this Ingress.
+	ing, err := r.Client.Experimental().Ingress(ingNamespace).Get(ingName)
+	if err != nil {
+		return nil, err
+	}
+	old, err := decodeReceivers(ing)
+	if err != nil {
+		return nil, err
+	}
+	receivers, err := mutate(copyReceivers(old))
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChange(ingName, ingNamespace, old, receivers, ClientSecretGetter(r.Client)); err != nil {
+		return nil, err
+	}
+	jsonReceivers, err := encodeReceiverList(receivers)
+	if err != nil {
+		return nil, err
+	}
+	if ing.Annotations == nil {
+		ing.Annotations = map[string]string{}
+	}
+	ing.Annotations[receiversKey] = jsonReceivers
+	if _, err := r.Client.Experimental().Ingress(ingNamespace).Update(ing); err != nil {
+		return nil, err
+	}
+	return receivers, nil
+}
+
+// Migrate rewrites every receivers annotation in the given namespace, or
+// across the cluster for api.NamespaceAll, that is still in the legacy
+// format. It returns the Ingresses it rewrote. Receivers aren't validated,
+// so invalid ones are carried over as is. Annotations that can't be decoded
+// are skipped and returned as an error once every other Ingress is
+// migrated.
+func (r *AnnotatedReceivers) Migrate(ingNamespace string) ([]IngressReceivers, error) {
+	ings, err := r.Client.Experimental().Ingress(ingNamespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	migrated := []IngressReceivers{}
+	skipped := []error{}
+	for i := range ings.Items {
+		ing := &ings.Items[i]
+		if jsonRec, ok := ingAnnotations(ing.Annotations).getReceivers(); !ok {
+			continue
+		} else if _, legacy, err := decodeReceiverList(jsonRec); err != nil {
+			skipped = append(skipped, fmt.Errorf("failed to decode receivers of %v/%v: %v", ing.Namespace, ing.Name, err))
+			continue
+		} else if !legacy {
+			continue
+		}
+		var rec []Receiver
+		err := retryOnConflict(fmt.Sprintf("receivers of %v/%v", ing.Namespace, ing.Name), func() (err error) {
+			rec, err = r.tryMigrate(ing.Name, ing.Namespace)
 			return err
+		})
+		if err != nil {
+			return migrated, err
 		}
-	}
-	newReceiver := true
-	for i := range receivers {
-		if receivers[i].Host == rec.Host {
-			receivers[i] = rec
-			newReceiver = false
+		if rec != nil {
+			migrated = append(migrated, IngressReceivers{Name: ing.Name, Namespace: ing.Namespace, Receivers: rec})
 		}
 	}
-	if newReceiver {
-		receivers = append(receivers, rec)
+	if len(skipped) != 0 {
+		return migrated, fmt.Errorf("skipped undecodable receivers: %v", utilerrors.NewAggregate(skipped))
 	}
-	jsonReceivers, err := json.Marshal(receivers)
+	return migrated, nil
+}
+
+// tryMigrate rewrites the receivers of a single Ingress in the current
+// format. It returns nil receivers if there was nothing to migrate.
+func (r *AnnotatedReceivers) tryMigrate(ingName, ingNamespace string) ([]Receiver, error) {
+	ing, err := r.Client.Experimental().Ingress(ingNamespace).Get(ingName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	jsonRec, ok := ingAnnotations(ing.Annotations).getReceivers()
+	if !ok {
+		return nil, nil
+	}
+	receivers, legacy, err := decodeReceiverList(jsonRec)
+	if err != nil || !legacy {
+		return nil, err
+	}
+	if ing.Annotations[receiversKey], err = encodeReceiverList(receivers); err != nil {
+		return nil, err
 	}
-	ing.Annotations[receiversKey] = string(jsonReceivers)
 	if _, err := r.Client.Experimental().Ingress(ingNamespace).Update(ing); err != nil {
-		return err
+		return nil, err
+	}
+	if receivers == nil {
+		receivers = []Receiver{}
 	}
-	return nil
+	return receivers, nil
 }
@@ -0,0 +1,130 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// fakeIngressServer serves gets, lists and updates of Ingresses in a
+// single namespace.
+type fakeIngressServer struct {
+	sync.Mutex
+	ings    map[string]*extensions.Ingress
+	updates int
+}
+
+func (f *fakeIngressServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	codec := testapi.Extensions.Codec()
+	name := ""
+	if i := strings.Index(req.URL.Path, "/ingress/"); i != -1 {
+		name = req.URL.Path[i+len("/ingress/"):]
+	}
+	var obj runtime.Object
+	switch {
+	case req.Method == "GET" && name == "":
+		names := []string{}
+		for name := range f.ings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := &extensions.IngressList{}
+		for _, name := range names {
+			list.Items = append(list.Items, *f.ings[name])
+		}
+		obj = list
+	case req.Method == "GET" && f.ings[name] != nil:
+		obj = f.ings[name]
+	case req.Method == "PUT" && f.ings[name] != nil:
+		ing := &extensions.Ingress{}
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil {
+			err = codec.DecodeInto(body, ing)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.ings[name] = ing
+		f.updates++
+		obj = ing
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	data, err := codec.Encode(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func TestMigrate(t *testing.T) {
+	legacy := `[{"host":"foo.com","port":443,"cert":"foosecret"}]`
+	current := `{"version":"v1","receivers":[{"host":"bar.com","port":443,"cert":"barsecret"}]}`
+	fake := &fakeIngressServer{ings: map[string]*extensions.Ingress{}}
+	for name, receivers := range map[string]string{
+		"legacy":  legacy,
+		"current": current,
+		"broken":  `{"version":"v2"}`,
+		"none":    "",
+	} {
+		ing := &extensions.Ingress{ObjectMeta: api.ObjectMeta{Name: name, Namespace: "ns", Annotations: map[string]string{}}}
+		if receivers != "" {
+			ing.Annotations[receiversKey] = receivers
+		}
+		fake.ings[name] = ing
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := client.NewOrDie(&client.Config{Host: server.URL, Version: testapi.Default.Version()})
+
+	migrated, err := (&AnnotatedReceivers{Client: c}).Migrate("ns")
+	if err == nil || !strings.Contains(err.Error(), "ns/broken") {
+		t.Errorf("expected the undecodable annotation of ns/broken to be reported, got %v", err)
+	}
+	expected := []IngressReceivers{{Name: "legacy", Namespace: "ns", Receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret"}}}}
+	if !reflect.DeepEqual(migrated, expected) {
+		t.Errorf("expected %+v to be migrated, got %+v", expected, migrated)
+	}
+	if fake.updates != 1 {
+		t.Errorf("expected only the legacy Ingress to be updated, got %v updates", fake.updates)
+	}
+	if got := fake.ings["legacy"].Annotations[receiversKey]; got != `{"version":"v1","receivers":[{"host":"foo.com","port":443,"cert":"foosecret"}]}` {
+		t.Errorf("unexpected migrated annotation %v", got)
+	}
+	if got := fake.ings["current"].Annotations[receiversKey]; got != current {
+		t.Errorf("expected the current annotation to be left alone, got %v", got)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+// defaultHTTPPort is the port implied by an Ingress rule, which can't carry
+// a port of its own.
+const defaultHTTPPort = 80
+
+// RoutingModel is the normalized routing of a single Ingress, built from
+// its rules, default backend and receivers annotation.
+type RoutingModel struct {
+	Servers []Server
+	// Warnings describe disagreements between the spec and the receivers,
+	// and how they were resolved.
+	Warnings []string
+}
+
+// Server is a host listening on a port. An empty Host matches every host.
+type Server struct {
+	Host string
+	Port int
+	// TLSSecret is the name of the secret holding the serving cert, empty
+	// for plain http.
+	TLSSecret string
+	// Routes are sorted by path.
+	Routes []Route
+}
+
+// Route sends requests matching Path to Backend.
+type Route struct {
+	Path    string
+	Match   PathMatchType
+	Backend extensions.IngressBackend
+}
+
+// BuildRoutingModel merges the spec and receivers of the Ingress into a
+// single RoutingModel. The precedence rules are:
+//   - Every host in Spec.Rules gets a plain http server on port 80, whose
+//     routes are the paths of all rules for that host. If a host has the
+//     same path twice, the first one wins.
+//   - Every receiver gets a server on its port, serving its cert, with the
+//     routes of the rules for its host. Paths of the receiver itself take
+//     precedence over rules with the same path and match type. A receiver
+//     on port 80 takes over the http server of its host. A receiver for a
+//     host without rules or paths only routes to the default backend.
+//   - Spec.Backend is the route for "/" on every server that doesn't
+//     define one, and a catch-all server on port 80 if there's no rule
+//     without a host.
+//
+// The extensions API vendored here has no Spec.TLS, so receivers are the
+// only source of TLS secrets.
+func BuildRoutingModel(ing *extensions.Ingress) (*RoutingModel, error) {
+	receivers, err := decodeReceivers(ing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode receivers of %v/%v: %v", ing.Namespace, ing.Name, err)
+	}
+	m := &RoutingModel{}
+	defaultBackend := ing.Spec.Backend
+
+	// Collect the routes of every host in the rules.
+	hosts := []string{}
+	routes := map[string][]Route{}
+	for _, rule := range ing.Spec.Rules {
+		if _, ok := routes[rule.Host]; !ok {
+			hosts = append(hosts, rule.Host)
+			routes[rule.Host] = []Route{}
+		}
+		if rule.HTTP == nil {
+			m.warnf("rule for host %q has no http paths", rule.Host)
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			path := p.Path
+			if path == "" {
+				path = "/"
+			}
+			if hasPath(routes[rule.Host], path, PathMatchPrefix) {
+				m.warnf("path %v of host %q is defined twice, using the first backend", path, rule.Host)
+				continue
+			}
+			routes[rule.Host] = append(routes[rule.Host], Route{Path: path, Match: PathMatchPrefix, Backend: p.Backend})
+		}
+	}
+	if defaultBackend != nil {
+		if _, ok := routes[""]; !ok {
+			hosts = append(hosts, "")
+			routes[""] = []Route{}
+		}
+	}
+
+	servers := map[string]*Server{}
+	addServer := func(host string, port int, secret string) *Server {
+		key := fmt.Sprintf("%v:%v", host, port)
+		if s, ok := servers[key]; ok {
+			if s.TLSSecret != "" && secret != "" && s.TLSSecret != secret {
+				m.warnf("host %q port %v has more than one cert, using %v", host, port, s.TLSSecret)
+			}
+			if s.TLSSecret == "" {
+				s.TLSSecret = secret
+			}
+			return s
+		}
+		s := &Server{Host: host, Port: port, TLSSecret: secret, Routes: append([]Route{}, routes[host]...)}
+		servers[key] = s
+		return s
+	}
+	for _, rec := range receivers {
+		s := addServer(rec.Host, rec.Port, rec.Cert)
+		for _, p := range rec.Paths {
+			route := Route{
+				Path:    p.Path,
+				Match:   p.MatchType(),
+				Backend: extensions.IngressBackend{ServiceName: p.ServiceName, ServicePort: p.ServicePort},
+			}
+			if i := pathIndex(s.Routes, route.Path, route.Match); i >= 0 {
+				if s.Routes[i].Backend != route.Backend {
+					m.warnf("receiver %v:%v overrides the backend of path %v", rec.Host, rec.Port, route.Path)
+				}
+				s.Routes[i] = route
+				continue
+			}
+			s.Routes = append(s.Routes, route)
+		}
+		if _, ok := routes[rec.Host]; !ok && len(rec.Paths) == 0 {
+			if defaultBackend == nil {
+				m.warnf("receiver %v:%v has no rule and the Ingress has no default backend", rec.Host, rec.Port)
+			} else {
+				m.warnf("receiver %v:%v has no rule, using the default backend", rec.Host, rec.Port)
+			}
+		}
+		if rec.Port == defaultHTTPPort {
+			if _, ok := routes[rec.Host]; ok {
+				m.warnf("receiver %v:%v overrides the http server of its rule", rec.Host, rec.Port)
+			}
+		}
+	}
+	for _, host := range hosts {
+		addServer(host, defaultHTTPPort, "")
+	}
+
+	for _, s := range servers {
+		if defaultBackend != nil && !hasPath(s.Routes, "/", PathMatchPrefix) {
+			s.Routes = append(s.Routes, Route{Path: "/", Match: PathMatchPrefix, Backend: *defaultBackend})
+		}
+		sort.Sort(byPath(s.Routes))
+		m.Servers = append(m.Servers, *s)
+	}
+	sort.Sort(byServer(m.Servers))
+	return m, nil
+}
+
+func (m *RoutingModel) warnf(format string, args ...interface{}) {
+	m.Warnings = append(m.Warnings, fmt.Sprintf(format, args...))
+}
+
+func hasPath(routes []Route, path string, match PathMatchType) bool {
+	return pathIndex(routes, path, match) >= 0
+}
+
+func pathIndex(routes []Route, path string, match PathMatchType) int {
+	for i, r := range routes {
+		if r.Path == path && r.Match == match {
+			return i
+		}
+	}
+	return -1
+}
+
+type byPath []Route
+
+func (r byPath) Len() int      { return len(r) }
+func (r byPath) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byPath) Less(i, j int) bool {
+	if r[i].Path != r[j].Path {
+		return r[i].Path < r[j].Path
+	}
+	return r[i].Match < r[j].Match
+}
+
+type byServer []Server
+
+func (s byServer) Len() int      { return len(s) }
+func (s byServer) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byServer) Less(i, j int) bool {
+	if s[i].Host != s[j].Host {
+		return s[i].Host < s[j].Host
+	}
+	return s[i].Port < s[j].Port
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+func backend(name string, port int) extensions.IngressBackend {
+	return extensions.IngressBackend{ServiceName: name, ServicePort: util.NewIntOrStringFromInt(port)}
+}
+
+func TestBuildRoutingModel(t *testing.T) {
+	def := backend("default", 80)
+	ing := &extensions.Ingress{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "ing",
+			Namespace: "ns",
+			Annotations: map[string]string{
+				receiversKey: `[{"host":"foo.com","port":443,"cert":"foosecret"},{"host":"bar.com","port":443,"cert":"barsecret"}]`,
+			},
+		},
+		Spec: extensions.IngressSpec{
+			Backend: &def,
+			Rules: []extensions.IngressRule{
+				{
+					Host: "foo.com",
+					IngressRuleValue: extensions.IngressRuleValue{HTTP: &extensions.HTTPIngressRuleValue{
+						Paths: []extensions.HTTPIngressPath{
+							{Path: "/foo", Backend: backend("foosvc", 80)},
+							{Path: "/foo", Backend: backend("othersvc", 80)},
+						},
+					}},
+				},
+			},
+		},
+	}
+	m, err := BuildRoutingModel(ing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defRoutes := []Route{{Path: "/", Match: PathMatchPrefix, Backend: def}}
+	fooRoutes := []Route{{Path: "/", Match: PathMatchPrefix, Backend: def}, {Path: "/foo", Match: PathMatchPrefix, Backend: backend("foosvc", 80)}}
+	expected := []Server{
+		{Host: "", Port: 80, Routes: defRoutes},
+		{Host: "bar.com", Port: 443, TLSSecret: "barsecret", Routes: defRoutes},
+		{Host: "foo.com", Port: 80, Routes: fooRoutes},
+		{Host: "foo.com", Port: 443, TLSSecret: "foosecret", Routes: fooRoutes},
+	}
+	if !reflect.DeepEqual(m.Servers, expected) {
+		t.Errorf("expected servers\n%+v\ngot\n%+v", expected, m.Servers)
+	}
+	if len(m.Warnings) != 2 {
+		t.Errorf("expected warnings for the duplicate path and the receiver without a rule, got %v", m.Warnings)
+	}
+
+	// Paths of a receiver override rules with the same path.
+	ing.Annotations[receiversKey] = `[{"host":"foo.com","port":443,"cert":"foosecret","paths":[{"path":"/foo","serviceName":"recsvc","servicePort":8080},{"path":"/bar","match":"Exact","serviceName":"barsvc","servicePort":"http"}]}]`
+	if m, err = BuildRoutingModel(ing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedRoutes := []Route{
+		{Path: "/", Match: PathMatchPrefix, Backend: def},
+		{Path: "/bar", Match: PathMatchExact, Backend: extensions.IngressBackend{ServiceName: "barsvc", ServicePort: util.NewIntOrStringFromString("http")}},
+		{Path: "/foo", Match: PathMatchPrefix, Backend: backend("recsvc", 8080)},
+	}
+	if s := m.Servers[len(m.Servers)-1]; !reflect.DeepEqual(s.Routes, expectedRoutes) {
+		t.Errorf("expected routes\n%+v\ngot\n%+v", expectedRoutes, s.Routes)
+	}
+}
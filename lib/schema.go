@@ -0,0 +1,65 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ReceiversVersion is the version of the receivers format written by this
+// package.
+const ReceiversVersion = "v1"
+
+// receiversEnvelope is the versioned format of a receivers list. Earlier
+// writers stored a bare json array of receivers, which is still read as the
+// legacy format.
+type receiversEnvelope struct {
+	Version   string     `json:"version"`
+	Receivers []Receiver `json:"receivers"`
+}
+
+// decodeReceiverList decodes either a versioned envelope or a legacy
+// array of receivers. legacy is true for the latter.
+func decodeReceiverList(data string) (rec []Receiver, legacy bool, err error) {
+	b := bytes.TrimSpace([]byte(data))
+	if len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &rec)
+		return rec, true, err
+	}
+	var envelope receiversEnvelope
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return nil, false, err
+	}
+	if envelope.Version != ReceiversVersion {
+		return nil, false, fmt.Errorf("unsupported receivers version %q, expected %q", envelope.Version, ReceiversVersion)
+	}
+	return envelope.Receivers, false, nil
+}
+
+// encodeReceiverList encodes receivers in the current versioned format.
+func encodeReceiverList(rec []Receiver) (string, error) {
+	if rec == nil {
+		rec = []Receiver{}
+	}
+	b, err := json.Marshal(receiversEnvelope{Version: ReceiversVersion, Receivers: rec})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
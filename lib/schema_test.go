@@ -0,0 +1,58 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReceiverListFormats(t *testing.T) {
+	foo := Receiver{Host: "foo.com", Port: 443, Cert: "foosecret"}
+
+	rec, legacy, err := decodeReceiverList(` [{"host":"foo.com","port":443,"cert":"foosecret"}]`)
+	if err != nil || !legacy || !reflect.DeepEqual(rec, []Receiver{foo}) {
+		t.Errorf("unexpected legacy decode: %+v, %v, %v", rec, legacy, err)
+	}
+
+	data, err := encodeReceiverList(rec)
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	var envelope map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &envelope); err != nil || envelope["version"] != ReceiversVersion {
+		t.Errorf("expected a %v envelope, got %v", ReceiversVersion, data)
+	}
+	if rec, legacy, err := decodeReceiverList(data); err != nil || legacy || !reflect.DeepEqual(rec, []Receiver{foo}) {
+		t.Errorf("unexpected envelope round trip of %v: %+v, %v, %v", data, rec, legacy, err)
+	}
+
+	if data, err := encodeReceiverList(nil); err != nil || data != `{"version":"v1","receivers":[]}` {
+		t.Errorf("unexpected encoding of no receivers: %v, %v", data, err)
+	}
+
+	for _, data := range []string{
+		`{"version":"v2","receivers":[]}`,
+		`{"receivers":[{"host":"foo.com","port":443,"cert":"foosecret"}]}`,
+		`not json`,
+	} {
+		if rec, _, err := decodeReceiverList(data); err == nil {
+			t.Errorf("expected %v to be rejected, got %+v", data, rec)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// maxUpdateRetries is the number of times a write will re-read and
+// re-merge its receivers after a resourceVersion conflict.
+const maxUpdateRetries = 5
+
+// initialUpdateBackoff is the delay before the first retry, it doubles on
+// every subsequent conflict. It's a var so tests can shorten it.
+var initialUpdateBackoff = 50 * time.Millisecond
+
+// ReceiverStore persists the receivers of Ingresses.
+type ReceiverStore interface {
+	// Get returns the receivers of the given Ingress.
+	Get(ingName, ingNamespace string) ([]Receiver, error)
+	// Update merges rec into the receivers of the given Ingress, replacing
+	// any existing receiver with the same Host and Port, and returns the
+	// merged list.
+	Update(ingName, ingNamespace string, rec Receiver) ([]Receiver, error)
+	// Remove deletes the receiver with the given host and port from the
+	// Ingress, or every receiver of the host for port 0, and returns the
+	// remaining receivers.
+	Remove(ingName, ingNamespace, host string, port int) ([]Receiver, error)
+	// ReplaceAll overwrites the receivers of the given Ingress.
+	ReplaceAll(ingName, ingNamespace string, rec []Receiver) ([]Receiver, error)
+	// List returns the receivers of every Ingress in the namespace, or
+	// across the cluster for api.NamespaceAll.
+	List(ingNamespace string) ([]IngressReceivers, error)
+	// Watch sends the receivers of every Ingress in the namespace, and then
+	// sends them again each time they change. An Ingress that lost all its
+	// receivers is sent with nil Receivers. The returned channel is closed
+	// once stopCh is closed.
+	Watch(ingNamespace string, stopCh <-chan struct{}) (<-chan IngressReceivers, error)
+}
+
+// receiverMutator computes a new list of receivers from the current one.
+type receiverMutator func([]Receiver) ([]Receiver, error)
+
+// mergeReceiver returns a mutator that replaces the receiver with the same
+// Host and Port as rec, or appends rec if there isn't one.
+func mergeReceiver(rec Receiver) receiverMutator {
+	return func(receivers []Receiver) ([]Receiver, error) {
+		newReceiver := true
+		for i := range receivers {
+			if receivers[i].Host == rec.Host && receivers[i].Port == rec.Port {
+				receivers[i] = rec
+				newReceiver = false
+			}
+		}
+		if newReceiver {
+			receivers = append(receivers, rec)
+		}
+		return receivers, nil
+	}
+}
+
+// removeReceiver returns a mutator that drops the receiver with the given
+// host and port, or every receiver of the host for port 0. It fails if no
+// receiver matched.
+func removeReceiver(host string, port int) receiverMutator {
+	return func(receivers []Receiver) ([]Receiver, error) {
+		remaining := []Receiver{}
+		for _, rec := range receivers {
+			if rec.Host != host || (port != 0 && rec.Port != port) {
+				remaining = append(remaining, rec)
+			}
+		}
+		if len(remaining) == len(receivers) {
+			if port != 0 {
+				return nil, fmt.Errorf("no receiver with host %v and port %v", host, port)
+			}
+			return nil, fmt.Errorf("no receiver with host %v", host)
+		}
+		return remaining, nil
+	}
+}
+
+// replaceReceivers returns a mutator that ignores the current receivers.
+func replaceReceivers(rec []Receiver) receiverMutator {
+	return func([]Receiver) ([]Receiver, error) {
+		if rec == nil {
+			return []Receiver{}, nil
+		}
+		return rec, nil
+	}
+}
+
+// retryOnConflict calls write until it succeeds, fails with an error other
+// than a conflict, or has been attempted maxUpdateRetries times. The delay
+// between attempts starts at initialUpdateBackoff and doubles every time.
+// The error of the last attempt is returned as is, so callers can still
+// check it with errors.IsConflict.
+func retryOnConflict(desc string, write func() error) (err error) {
+	backoff := initialUpdateBackoff
+	for i := 0; ; i++ {
+		if err = write(); err == nil || !(errors.IsConflict(err) || errors.IsAlreadyExists(err)) {
+			return
+		}
+		if i == maxUpdateRetries-1 {
+			glog.Warningf("Giving up updating %v after %v conflicts", desc, maxUpdateRetries)
+			return
+		}
+		glog.V(2).Infof("Conflict updating %v, retrying in %v", desc, backoff)
+		time.Sleep(wait.Jitter(backoff, 1.0))
+		backoff *= 2
+	}
+}
+
+// validate returns an *InvalidReceiversError if any of the receivers have
+// bad fields or, when getSecret is not nil, reference a missing or
+// unparseable secret.
+func validate(ingName, ingNamespace string, rec []Receiver, getSecret SecretGetter) error {
+	allErrs := ValidateReceivers(rec)
+	if getSecret != nil {
+		allErrs = append(allErrs, ValidateReceiverCerts(rec, ingNamespace, getSecret)...)
+	}
+	if len(allErrs) != 0 {
+		return &InvalidReceiversError{Name: ingName, Namespace: ingNamespace, Errors: allErrs}
+	}
+	return nil
+}
+
+// validateChange is validate for a mutation of old into rec. Only the
+// secrets of new or changed receivers are checked, so a receiver whose
+// secret was deleted doesn't block changes to, or the removal of, the
+// others.
+func validateChange(ingName, ingNamespace string, old, rec []Receiver, getSecret SecretGetter) error {
+	allErrs := ValidateReceivers(rec)
+	if getSecret != nil {
+		touched := make([]Receiver, len(rec))
+		for i := range rec {
+			touched[i] = rec[i]
+			for _, o := range old {
+				if reflect.DeepEqual(o, rec[i]) {
+					// ValidateReceiverCerts skips receivers without a cert.
+					touched[i].Cert = ""
+					break
+				}
+			}
+		}
+		allErrs = append(allErrs, ValidateReceiverCerts(touched, ingNamespace, getSecret)...)
+	}
+	if len(allErrs) != 0 {
+		return &InvalidReceiversError{Name: ingName, Namespace: ingNamespace, Errors: allErrs}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+)
+
+func TestRetryOnConflict(t *testing.T) {
+	defer func(backoff time.Duration) { initialUpdateBackoff = backoff }(initialUpdateBackoff)
+	initialUpdateBackoff = 10 * time.Millisecond
+
+	conflict := errors.NewConflict("ingress", "foo", fmt.Errorf("resourceVersion changed"))
+	other := fmt.Errorf("connection refused")
+	testCases := []struct {
+		desc string
+		// errs are returned by successive writes, nil once they run out.
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{desc: "success", attempts: 1},
+		{desc: "conflicts then success", errs: []error{conflict, conflict}, attempts: 3},
+		{desc: "other error", errs: []error{conflict, other}, attempts: 2, err: other},
+		{desc: "only conflicts", errs: []error{conflict, conflict, conflict, conflict, conflict, conflict}, attempts: maxUpdateRetries, err: conflict},
+	}
+	for _, tc := range testCases {
+		attempts := 0
+		var lastAttempt time.Time
+		err := retryOnConflict(tc.desc, func() error {
+			attempts++
+			lastAttempt = time.Now()
+			if attempts <= len(tc.errs) {
+				return tc.errs[attempts-1]
+			}
+			return nil
+		})
+		if err != tc.err {
+			t.Errorf("%v: expected error %v, got %v", tc.desc, tc.err, err)
+		}
+		if attempts != tc.attempts {
+			t.Errorf("%v: expected %v attempts, got %v", tc.desc, tc.attempts, attempts)
+		}
+		if waited := time.Since(lastAttempt); waited >= initialUpdateBackoff {
+			t.Errorf("%v: expected no delay after the last attempt, waited %v", tc.desc, waited)
+		}
+	}
+	if err := retryOnConflict("conflict", func() error { return conflict }); !errors.IsConflict(err) {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
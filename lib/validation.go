@@ -0,0 +1,218 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/util"
+	"k8s.io/kubernetes/pkg/util/fielderrors"
+	"k8s.io/kubernetes/pkg/util/validation"
+)
+
+const (
+	// Key names of a secret created by kubectl create secret tls.
+	tlsCertKey       = "tls.crt"
+	tlsPrivateKeyKey = "tls.key"
+
+	// Suffixes of the "<app>.crt" and "<app>.key" keys written by hack/make_secret.go.
+	certSuffix = ".crt"
+	keySuffix  = ".key"
+)
+
+// SecretGetter fetches a secret by namespace and name.
+type SecretGetter func(namespace, name string) (*api.Secret, error)
+
+// InvalidReceiversError is returned when the receivers of an Ingress fail
+// validation. Errors holds one *fielderrors.ValidationError per bad field.
+type InvalidReceiversError struct {
+	Name      string
+	Namespace string
+	Errors    fielderrors.ValidationErrorList
+}
+
+func (e *InvalidReceiversError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid receivers in %v/%v: [%v]", e.Namespace, e.Name, strings.Join(msgs, ", "))
+}
+
+// ValidateReceivers checks the fields of the given receivers without talking
+// to the apiserver: host syntax, port range, duplicate host/port pairs and
+// the path rules of each receiver.
+func ValidateReceivers(receivers []Receiver) fielderrors.ValidationErrorList {
+	allErrs := fielderrors.ValidationErrorList{}
+	seen := map[string]bool{}
+	for i, rec := range receivers {
+		recErrs := fielderrors.ValidationErrorList{}
+		if rec.Host == "" {
+			recErrs = append(recErrs, fielderrors.NewFieldRequired("host"))
+		} else if !isValidHost(rec.Host) {
+			recErrs = append(recErrs, fielderrors.NewFieldInvalid("host", rec.Host, "must be a DNS-1123 subdomain, optionally prefixed with *."))
+		}
+		if !validation.IsValidPortNum(rec.Port) {
+			recErrs = append(recErrs, fielderrors.NewFieldInvalid("port", rec.Port, "must be between 1 and 65535"))
+		}
+		if rec.Cert == "" {
+			recErrs = append(recErrs, fielderrors.NewFieldRequired("cert"))
+		} else if !validation.IsDNS1123Subdomain(rec.Cert) {
+			recErrs = append(recErrs, fielderrors.NewFieldInvalid("cert", rec.Cert, "must be the name of a secret"))
+		}
+		hostPort := fmt.Sprintf("%v:%v", rec.Host, rec.Port)
+		if seen[hostPort] {
+			recErrs = append(recErrs, fielderrors.NewFieldDuplicate("host", hostPort))
+		}
+		seen[hostPort] = true
+		recErrs = append(recErrs, validatePathRules(rec.Paths).Prefix("paths")...)
+		allErrs = append(allErrs, recErrs.PrefixIndex(i).Prefix("receivers")...)
+	}
+	return allErrs
+}
+
+// ValidateReceiverCerts checks that the secret named by each receiver exists
+// in the given namespace and holds a parseable certificate and key pair.
+func ValidateReceiverCerts(receivers []Receiver, namespace string, getSecret SecretGetter) fielderrors.ValidationErrorList {
+	allErrs := fielderrors.ValidationErrorList{}
+	for i, rec := range receivers {
+		if rec.Cert == "" {
+			continue
+		}
+		field := fmt.Sprintf("receivers[%d].cert", i)
+		secret, err := getSecret(namespace, rec.Cert)
+		if errors.IsNotFound(err) {
+			allErrs = append(allErrs, fielderrors.NewFieldNotFound(field, rec.Cert))
+			continue
+		} else if err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(field, rec.Cert, err.Error()))
+			continue
+		}
+		if _, err := certFromSecret(secret); err != nil {
+			allErrs = append(allErrs, fielderrors.NewFieldInvalid(field, rec.Cert, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// validatePathRules checks the path, match type and backend of each rule,
+// and that no path is matched the same way twice.
+func validatePathRules(paths []PathRule) fielderrors.ValidationErrorList {
+	allErrs := fielderrors.ValidationErrorList{}
+	seen := map[string]bool{}
+	for i, p := range paths {
+		pathErrs := fielderrors.ValidationErrorList{}
+		switch p.MatchType() {
+		case PathMatchPrefix, PathMatchExact:
+			if !strings.HasPrefix(p.Path, "/") {
+				pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("path", p.Path, "must begin with /"))
+			}
+		case PathMatchRegex:
+			if _, err := regexp.Compile(p.Path); err != nil {
+				pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("path", p.Path, err.Error()))
+			}
+		default:
+			pathErrs = append(pathErrs, fielderrors.NewFieldValueNotSupported("match", p.Match,
+				[]string{string(PathMatchPrefix), string(PathMatchExact), string(PathMatchRegex)}))
+		}
+		if err := ValidatePathSyntax(p.Path, p.MatchType()); err != nil {
+			pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("path", p.Path, err.Error()))
+		}
+		key := fmt.Sprintf("%v %v", p.MatchType(), p.Path)
+		if seen[key] {
+			pathErrs = append(pathErrs, fielderrors.NewFieldDuplicate("path", p.Path))
+		}
+		seen[key] = true
+		if !validation.IsDNS952Label(p.ServiceName) {
+			pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("serviceName", p.ServiceName, "must be the name of a service"))
+		}
+		switch p.ServicePort.Kind {
+		case util.IntstrInt:
+			if !validation.IsValidPortNum(p.ServicePort.IntVal) {
+				pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("servicePort", p.ServicePort.IntVal, "must be between 1 and 65535"))
+			}
+		case util.IntstrString:
+			if !validation.IsValidPortName(p.ServicePort.StrVal) {
+				pathErrs = append(pathErrs, fielderrors.NewFieldInvalid("servicePort", p.ServicePort.StrVal, "must be a port name"))
+			}
+		}
+		allErrs = append(allErrs, pathErrs.PrefixIndex(i)...)
+	}
+	return allErrs
+}
+
+// unsafePathChars can't appear in a path, since renderers write paths into
+// config files shared by every Ingress, eg: nginx.conf, where they could end
+// a statement or block. Braces are allowed in regexes, eg: ^/v[0-9]{1,2}/,
+// so renderers must quote regexes.
+const unsafePathChars = ";\"'"
+
+// ValidatePathSyntax rejects paths holding whitespace, semicolons or quotes,
+// and braces outside regexes.
+func ValidatePathSyntax(path string, match PathMatchType) error {
+	chars := unsafePathChars
+	if match != PathMatchRegex {
+		chars += "{}"
+	}
+	if strings.ContainsAny(path, chars) || strings.IndexFunc(path, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("must not contain whitespace or any of %v", chars)
+	}
+	return nil
+}
+
+// isValidHost returns true if host is a DNS-1123 subdomain or a wildcard
+// of one, eg: *.foo.com.
+func isValidHost(host string) bool {
+	if strings.HasPrefix(host, "*.") {
+		host = host[2:]
+	}
+	return validation.IsDNS1123Subdomain(host)
+}
+
+// certKeyPair returns the PEM encoded certificate and key stored in the
+// secret. It understands both the tls.crt/tls.key layout and the
+// <app>.crt/<app>.key layout written by hack/make_secret.go.
+func certKeyPair(secret *api.Secret) (crt, key []byte, err error) {
+	crt, crtOk := secret.Data[tlsCertKey]
+	key, keyOk := secret.Data[tlsPrivateKeyKey]
+	if crtOk && keyOk {
+		return crt, key, nil
+	}
+	// Iterate in a stable order so a secret with several pairs always
+	// resolves to the same one.
+	names := []string{}
+	for k := range secret.Data {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if !strings.HasSuffix(k, certSuffix) {
+			continue
+		}
+		app := strings.TrimSuffix(k, certSuffix)
+		if key, ok := secret.Data[app+keySuffix]; ok {
+			return secret.Data[k], key, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("secret %v/%v has no %v/%v or <app>%v/<app>%v pair", secret.Namespace, secret.Name, tlsCertKey, tlsPrivateKeyKey, certSuffix, keySuffix)
+}
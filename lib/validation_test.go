@@ -0,0 +1,143 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/util"
+	"k8s.io/kubernetes/pkg/util/fielderrors"
+)
+
+func TestValidateReceivers(t *testing.T) {
+	testCases := []struct {
+		receivers []Receiver
+		fields    []string
+	}{
+		{
+			receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret"}},
+		},
+		{
+			receivers: []Receiver{{Host: "*.foo.com", Port: 443, Cert: "foosecret"}},
+		},
+		{
+			receivers: []Receiver{{Host: "", Port: 0, Cert: ""}},
+			fields:    []string{"receivers[0].host", "receivers[0].port", "receivers[0].cert"},
+		},
+		{
+			receivers: []Receiver{{Host: "foo.*.com", Port: 70000, Cert: "foosecret"}},
+			fields:    []string{"receivers[0].host", "receivers[0].port"},
+		},
+		{
+			receivers: []Receiver{
+				{Host: "foo.com", Port: 443, Cert: "foosecret"},
+				{Host: "foo.com", Port: 443, Cert: "barsecret"},
+			},
+			fields: []string{"receivers[1].host"},
+		},
+		{
+			receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret", Paths: []PathRule{
+				{Path: "/foo", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "/foo", Match: PathMatchExact, ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromString("http")},
+				{Path: "^/(a|b)$", Match: PathMatchRegex, ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+			}}},
+		},
+		{
+			receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret", Paths: []PathRule{
+				{Path: "foo", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "/foo", Match: "Fuzzy", ServiceName: "Foo_svc", ServicePort: util.NewIntOrStringFromInt(0)},
+				{Path: "(", Match: PathMatchRegex, ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+			}}},
+			fields: []string{
+				"receivers[0].paths[0].path",
+				"receivers[0].paths[1].match", "receivers[0].paths[1].serviceName", "receivers[0].paths[1].servicePort",
+				"receivers[0].paths[2].path",
+			},
+		},
+		{
+			receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret", Paths: []PathRule{
+				{Path: "^/v[0-9]{1,2}/", Match: PathMatchRegex, ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "/a;b", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "/a b", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "/{a}", ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+				{Path: "^/a; deny all", Match: PathMatchRegex, ServiceName: "foosvc", ServicePort: util.NewIntOrStringFromInt(80)},
+			}}},
+			fields: []string{
+				"receivers[0].paths[1].path", "receivers[0].paths[2].path",
+				"receivers[0].paths[3].path", "receivers[0].paths[4].path",
+			},
+		},
+	}
+	for i, tc := range testCases {
+		errs := ValidateReceivers(tc.receivers)
+		if len(errs) != len(tc.fields) {
+			t.Errorf("%d: expected %d errors, got %v", i, len(tc.fields), errs)
+			continue
+		}
+		for j, err := range errs {
+			if field := err.(*fielderrors.ValidationError).Field; field != tc.fields[j] {
+				t.Errorf("%d: expected error on %v, got %v", i, tc.fields[j], field)
+			}
+		}
+	}
+}
+
+func TestValidateReceiverCerts(t *testing.T) {
+	crt, key := selfSignedCert(t, "foo.com")
+	_, otherKey := selfSignedCert(t, "bar.com")
+	secrets := map[string]*api.Secret{
+		"tls":      {ObjectMeta: api.ObjectMeta{Name: "tls"}, Data: map[string][]byte{"tls.crt": crt, "tls.key": key}},
+		"nokey":    {ObjectMeta: api.ObjectMeta{Name: "nokey"}, Data: map[string][]byte{"tls.crt": crt}},
+		"empty":    {ObjectMeta: api.ObjectMeta{Name: "empty"}, Data: map[string][]byte{"ca.crt": crt}},
+		"mismatch": {ObjectMeta: api.ObjectMeta{Name: "mismatch"}, Data: map[string][]byte{"tls.crt": crt, "tls.key": otherKey}},
+	}
+	getSecret := func(namespace, name string) (*api.Secret, error) {
+		if secret, ok := secrets[name]; ok {
+			return secret, nil
+		}
+		return nil, errors.NewNotFound("secrets", name)
+	}
+	testCases := []struct {
+		cert    string
+		errType fielderrors.ValidationErrorType
+	}{
+		{cert: "tls"},
+		{cert: "missing", errType: fielderrors.ValidationErrorTypeNotFound},
+		{cert: "nokey", errType: fielderrors.ValidationErrorTypeInvalid},
+		{cert: "empty", errType: fielderrors.ValidationErrorTypeInvalid},
+		{cert: "mismatch", errType: fielderrors.ValidationErrorTypeInvalid},
+	}
+	for _, tc := range testCases {
+		receivers := []Receiver{{Host: "bar.com", Port: 443}, {Host: "foo.com", Port: 443, Cert: tc.cert}}
+		errs := ValidateReceiverCerts(receivers, "ns", getSecret)
+		if tc.errType == "" {
+			if len(errs) != 0 {
+				t.Errorf("%v: unexpected errors %v", tc.cert, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%v: expected 1 error, got %v", tc.cert, errs)
+			continue
+		}
+		if err := errs[0].(*fielderrors.ValidationError); err.Type != tc.errType || err.Field != "receivers[1].cert" {
+			t.Errorf("%v: expected a %v error on receivers[1].cert, got %v", tc.cert, tc.errType, err)
+		}
+	}
+}
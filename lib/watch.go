@@ -0,0 +1,267 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// relistPeriod is how long a snapshotSource waits before listing again
+// after its watch failed or was closed by the apiserver.
+const relistPeriod = time.Second
+
+// scopedSnapshot is the complete set of receivers within a scope. The scope
+// is whatever a single watched object holds: one Ingress for annotations,
+// or every Ingress of a namespace for a ConfigMap.
+type scopedSnapshot struct {
+	scope     string
+	receivers []IngressReceivers
+	// err is set if the scope couldn't be decoded, eg: a bad annotation.
+	// The scope keeps its last known receivers, rather than failing the
+	// whole list.
+	err error
+}
+
+// snapshotSource turns a list and watch of the objects backing a
+// ReceiverStore into a stream of per Ingress receivers. It only sends an
+// Ingress when its receivers actually change.
+type snapshotSource struct {
+	// list returns the current snapshot of every scope, and the
+	// resourceVersion to start watching from.
+	list func() ([]scopedSnapshot, string, error)
+	// watch starts watching the backing objects at resourceVersion.
+	watch func(resourceVersion string) (watch.Interface, error)
+	// decode converts a watch event into the new snapshot of one scope.
+	decode func(watch.Event) (scopedSnapshot, error)
+
+	// known is the last set of receivers sent, by scope and Ingress.
+	known map[string]map[string]IngressReceivers
+	out   chan IngressReceivers
+}
+
+// run does an initial list so errors reach the caller, and then keeps
+// watching in the background until stopCh is closed.
+func (s *snapshotSource) run(stopCh <-chan struct{}) (<-chan IngressReceivers, error) {
+	snapshots, resourceVersion, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	s.known = map[string]map[string]IngressReceivers{}
+	s.out = make(chan IngressReceivers)
+	go func() {
+		defer close(s.out)
+		for {
+			if !s.sync(snapshots, stopCh) || !s.watchFrom(resourceVersion, stopCh) {
+				return
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(relistPeriod):
+			}
+			if snapshots, resourceVersion, err = s.list(); err != nil {
+				glog.Errorf("Failed to list receivers: %v", err)
+				snapshots = nil
+				continue
+			}
+		}
+	}()
+	return s.out, nil
+}
+
+// sync sends the difference between the known scopes and a fresh list of
+// snapshots. Scopes missing from the list have lost all their receivers.
+// It returns false if stopCh was closed.
+func (s *snapshotSource) sync(snapshots []scopedSnapshot, stopCh <-chan struct{}) bool {
+	if snapshots == nil {
+		return true
+	}
+	listed := map[string]bool{}
+	for _, snapshot := range snapshots {
+		listed[snapshot.scope] = true
+		if snapshot.err != nil {
+			glog.Errorf("Keeping the last known receivers of %v: %v", snapshot.scope, snapshot.err)
+			continue
+		}
+		if !s.apply(snapshot, stopCh) {
+			return false
+		}
+	}
+	for scope := range s.known {
+		if !listed[scope] && !s.apply(scopedSnapshot{scope: scope}, stopCh) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchFrom applies watch events until the watch ends. It returns false if
+// stopCh was closed.
+func (s *snapshotSource) watchFrom(resourceVersion string, stopCh <-chan struct{}) bool {
+	w, err := s.watch(resourceVersion)
+	if err != nil {
+		glog.Errorf("Failed to watch receivers: %v", err)
+		return true
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return false
+		case event, ok := <-w.ResultChan():
+			if !ok || event.Type == watch.Error {
+				glog.V(2).Infof("Receiver watch ended, relisting")
+				return true
+			}
+			snapshot, err := s.decode(event)
+			if err != nil {
+				glog.Errorf("Ignoring receiver watch event: %v", err)
+				continue
+			}
+			if !s.apply(snapshot, stopCh) {
+				return false
+			}
+		}
+	}
+}
+
+// apply records the new snapshot of a scope and sends every Ingress in it
+// whose receivers changed. It returns false if stopCh was closed.
+func (s *snapshotSource) apply(snapshot scopedSnapshot, stopCh <-chan struct{}) bool {
+	old := s.known[snapshot.scope]
+	current := map[string]IngressReceivers{}
+	for _, ir := range snapshot.receivers {
+		current[ir.Namespace+"/"+ir.Name] = ir
+	}
+	changed := []IngressReceivers{}
+	for key, ir := range current {
+		if prev, ok := old[key]; !ok || !reflect.DeepEqual(prev.Receivers, ir.Receivers) {
+			changed = append(changed, ir)
+		}
+	}
+	for key, ir := range old {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, IngressReceivers{Name: ir.Name, Namespace: ir.Namespace})
+		}
+	}
+	if len(current) == 0 {
+		delete(s.known, snapshot.scope)
+	} else {
+		s.known[snapshot.scope] = current
+	}
+	for _, ir := range changed {
+		select {
+		case <-stopCh:
+			return false
+		case s.out <- ir:
+		}
+	}
+	return true
+}
+
+// ReceiverEventType is the kind of change to a single receiver.
+type ReceiverEventType string
+
+const (
+	ReceiverAdded    ReceiverEventType = "ADDED"
+	ReceiverModified ReceiverEventType = "MODIFIED"
+	ReceiverRemoved  ReceiverEventType = "REMOVED"
+)
+
+// ReceiverEvent describes a change to one receiver of an Ingress.
+// Receivers are identified by Host, as in Update.
+type ReceiverEvent struct {
+	Type         ReceiverEventType
+	IngName      string
+	IngNamespace string
+	// Receiver is the new value, or the removed value for ReceiverRemoved.
+	Receiver Receiver
+	// Previous is the value before a ReceiverModified or ReceiverRemoved,
+	// nil for ReceiverAdded.
+	Previous *Receiver
+}
+
+// WatchReceivers watches the given store and sends an event for every
+// receiver that is added, modified or removed in the namespace. Receivers
+// that exist when the watch starts are sent as added. The returned channel
+// is closed once stopCh is closed.
+func WatchReceivers(store ReceiverStore, ingNamespace string, stopCh <-chan struct{}) (<-chan ReceiverEvent, error) {
+	updates, err := store.Watch(ingNamespace, stopCh)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan ReceiverEvent)
+	go func() {
+		defer close(out)
+		known := map[string][]Receiver{}
+		for ir := range updates {
+			key := ir.Namespace + "/" + ir.Name
+			events := diffReceivers(ir.Name, ir.Namespace, known[key], ir.Receivers)
+			if len(ir.Receivers) == 0 {
+				delete(known, key)
+			} else {
+				known[key] = ir.Receivers
+			}
+			for _, event := range events {
+				select {
+				case <-stopCh:
+					return
+				case out <- event:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// diffReceivers returns the events that turn old into new, in the order
+// the receivers appear in new followed by removals in the order of old.
+// Receivers are matched by host and port.
+func diffReceivers(ingName, ingNamespace string, old, new []Receiver) []ReceiverEvent {
+	hostPort := func(rec Receiver) string {
+		return fmt.Sprintf("%v:%v", rec.Host, rec.Port)
+	}
+	oldByHostPort := map[string]Receiver{}
+	for _, rec := range old {
+		oldByHostPort[hostPort(rec)] = rec
+	}
+	newHostPorts := map[string]bool{}
+	events := []ReceiverEvent{}
+	for _, rec := range new {
+		newHostPorts[hostPort(rec)] = true
+		prev, ok := oldByHostPort[hostPort(rec)]
+		switch {
+		case !ok:
+			events = append(events, ReceiverEvent{Type: ReceiverAdded, IngName: ingName, IngNamespace: ingNamespace, Receiver: rec})
+		case !reflect.DeepEqual(prev, rec):
+			p := prev
+			events = append(events, ReceiverEvent{Type: ReceiverModified, IngName: ingName, IngNamespace: ingNamespace, Receiver: rec, Previous: &p})
+		}
+	}
+	for _, rec := range old {
+		if !newHostPorts[hostPort(rec)] {
+			p := rec
+			events = append(events, ReceiverEvent{Type: ReceiverRemoved, IngName: ingName, IngNamespace: ingNamespace, Receiver: rec, Previous: &p})
+		}
+	}
+	return events
+}
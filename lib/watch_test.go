@@ -0,0 +1,94 @@
+/*
+Copyright 2015 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWatchReceivers(t *testing.T) {
+	foo := Receiver{Host: "foo.com", Port: 443, Cert: "foosecret"}
+	bar := Receiver{Host: "bar.com", Port: 443, Cert: "barsecret"}
+	store := NewMemoryReceivers(IngressReceivers{Name: "ing", Namespace: "ns", Receivers: []Receiver{foo}})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	events, err := WatchReceivers(store, "ns", stopCh)
+	if err != nil {
+		t.Fatalf("unexpected error watching: %v", err)
+	}
+	expectEvent := func(expected ReceiverEvent) {
+		if event := <-events; !reflect.DeepEqual(event, expected) {
+			t.Errorf("expected %+v, got %+v", expected, event)
+		}
+	}
+	expectEvent(ReceiverEvent{Type: ReceiverAdded, IngName: "ing", IngNamespace: "ns", Receiver: foo})
+
+	store.Update("ing", "ns", bar)
+	expectEvent(ReceiverEvent{Type: ReceiverAdded, IngName: "ing", IngNamespace: "ns", Receiver: bar})
+
+	newFoo := Receiver{Host: "foo.com", Port: 443, Cert: "othersecret"}
+	store.Update("ing", "ns", newFoo)
+	expectEvent(ReceiverEvent{Type: ReceiverModified, IngName: "ing", IngNamespace: "ns", Receiver: newFoo, Previous: &foo})
+
+	foo8443 := Receiver{Host: "foo.com", Port: 8443, Cert: "foosecret"}
+	store.Update("ing", "ns", foo8443)
+	expectEvent(ReceiverEvent{Type: ReceiverAdded, IngName: "ing", IngNamespace: "ns", Receiver: foo8443})
+
+	store.ReplaceAll("ing", "ns", nil)
+	expectEvent(ReceiverEvent{Type: ReceiverRemoved, IngName: "ing", IngNamespace: "ns", Receiver: newFoo, Previous: &newFoo})
+	expectEvent(ReceiverEvent{Type: ReceiverRemoved, IngName: "ing", IngNamespace: "ns", Receiver: bar, Previous: &bar})
+	expectEvent(ReceiverEvent{Type: ReceiverRemoved, IngName: "ing", IngNamespace: "ns", Receiver: foo8443, Previous: &foo8443})
+}
+
+func TestSnapshotSourceKeepsUndecodableScopes(t *testing.T) {
+	foo := IngressReceivers{Name: "a", Namespace: "ns", Receivers: []Receiver{{Host: "foo.com", Port: 443, Cert: "foosecret"}}}
+	bar := IngressReceivers{Name: "b", Namespace: "ns", Receivers: []Receiver{{Host: "bar.com", Port: 443, Cert: "barsecret"}}}
+	s := &snapshotSource{known: map[string]map[string]IngressReceivers{}, out: make(chan IngressReceivers, 4)}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	s.sync([]scopedSnapshot{
+		{scope: "ns/a", receivers: []IngressReceivers{foo}},
+		{scope: "ns/b", err: fmt.Errorf("bad annotation")},
+	}, stopCh)
+	if sent := <-s.out; !reflect.DeepEqual(sent, foo) || len(s.out) != 0 {
+		t.Errorf("expected only %+v to be sent, got %+v and %d more", foo, sent, len(s.out))
+	}
+
+	s.sync([]scopedSnapshot{
+		{scope: "ns/a", receivers: []IngressReceivers{foo}},
+		{scope: "ns/b", receivers: []IngressReceivers{bar}},
+	}, stopCh)
+	if sent := <-s.out; !reflect.DeepEqual(sent, bar) {
+		t.Errorf("expected %+v, got %+v", bar, sent)
+	}
+
+	// An Ingress that breaks keeps its receivers, instead of losing them.
+	s.sync([]scopedSnapshot{
+		{scope: "ns/a"},
+		{scope: "ns/b", err: fmt.Errorf("bad annotation")},
+	}, stopCh)
+	if sent, expected := <-s.out, (IngressReceivers{Name: "a", Namespace: "ns"}); !reflect.DeepEqual(sent, expected) || len(s.out) != 0 {
+		t.Errorf("expected only %+v to be sent, got %+v and %d more", expected, sent, len(s.out))
+	}
+	if _, ok := s.known["ns/b"]; !ok {
+		t.Errorf("expected the receivers of ns/b to be kept")
+	}
+}